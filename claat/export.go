@@ -22,7 +22,9 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 
+	"github.com/CloudVLab/tools/claat/parser/gdoc"
 	"github.com/CloudVLab/tools/claat/render"
 	"github.com/CloudVLab/tools/claat/types"
 )
@@ -32,21 +34,30 @@ func cmdExport() {
 	if flag.NArg() == 0 {
 		fatalf("Need at least one source. Try '-h' for options.")
 	}
+	if _, err := highlightTheme(*highlight); err != nil {
+		fatalf("%v", err)
+	}
+	style, profile, err := readProfile(*styleFile)
+	if err != nil {
+		fatalf("%v", err)
+	}
 	type result struct {
 		src  string
 		meta *types.Meta
+		warn []*types.Warning
 		err  error
 	}
 	args := unique(flag.Args())
 	ch := make(chan *result, len(args))
 	for _, src := range args {
 		go func(src string) {
-			meta, err := exportCodelab(src, !*skipFragments)
-			ch <- &result{src, meta, err}
+			meta, warn, err := exportCodelab(src, !*skipFragments, style, profile)
+			ch <- &result{src, meta, warn, err}
 		}(src)
 	}
 	for _ = range args {
 		res := <-ch
+		printWarnings(res.src, res.warn)
 		if res.err != nil {
 			errorf(reportErr, res.src, res.err)
 		} else if !isStdout(*output) {
@@ -64,16 +75,21 @@ func cmdExport() {
 // There's a special case where basedir has a value of "-", in which
 // nothing is stored on disk and the only output, codelab formatted content,
 // is printed to stdout.
-func exportCodelab(src string, parseFragments bool) (*types.Meta, error) {
-	clab, err := slurpCodelab(src, parseFragments)
+//
+// Google Doc sources are parsed with profile, read from the style file,
+// or the default profile if nil.
+//
+// The returned warnings are the non-fatal problems found while parsing src.
+func exportCodelab(src string, parseFragments bool, style string, profile *gdoc.StyleProfile) (*types.Meta, []*types.Warning, error) {
+	clab, err := slurpCodelab(src, parseFragments, profile)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	var client *http.Client // need for downloadImages
 	if clab.typ == srcGoogleDoc {
 		client, err = driveClient()
 		if err != nil {
-			return nil, err
+			return nil, clab.Warnings, err
 		}
 	}
 
@@ -81,12 +97,14 @@ func exportCodelab(src string, parseFragments bool) (*types.Meta, error) {
 	lastmod := types.ContextTime(clab.mod)
 	meta := &clab.Meta
 	ctx := &types.Context{
-		Source:  src,
-		Env:     *expenv,
-		Format:  *tmplout,
-		Prefix:  *prefix,
-		MainGA:  *globalGA,
-		Updated: &lastmod,
+		Source:    src,
+		Env:       *expenv,
+		Format:    *tmplout,
+		Prefix:    *prefix,
+		MainGA:    *globalGA,
+		Style:     style,
+		Highlight: *highlight,
+		Updated:   &lastmod,
 	}
 
 	dir := *output // output dir or stdout
@@ -95,11 +113,24 @@ func exportCodelab(src string, parseFragments bool) (*types.Meta, error) {
 		// download or copy codelab assets to disk, and rewrite image URLs
 		mdir := filepath.Join(dir, imgDirname)
 		if _, err := slurpImages(client, src, mdir, clab.Steps); err != nil {
-			return nil, err
+			return nil, clab.Warnings, err
 		}
 	}
 	// write codelab and its metadata to disk
-	return meta, writeCodelab(dir, clab.Codelab, ctx)
+	return meta, clab.Warnings, writeCodelab(dir, clab.Codelab, ctx)
+}
+
+// highlightTheme returns the built-in theme of code highlighted server-side,
+// specified by name, or nil if name is empty.
+func highlightTheme(name string) (*render.Theme, error) {
+	if name == "" {
+		return nil, nil
+	}
+	t, ok := render.LookupTheme(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown highlight theme %q; available themes: %s", name, strings.Join(render.Themes(), ", "))
+	}
+	return t, nil
 }
 
 // writeCodelab stores codelab main content in ctx.Format and its metadata
@@ -119,6 +150,16 @@ func writeCodelab(dir string, clab *types.Codelab, ctx *types.Context) error {
 		}
 	}
 
+	// server-side code highlighting
+	var opt []render.Option
+	theme, err := highlightTheme(ctx.Highlight)
+	if err != nil {
+		return err
+	}
+	if theme != nil {
+		opt = append(opt, render.WithHighlight(theme))
+	}
+
 	// main content file(s)
 	data := &struct {
 		render.Context
@@ -153,7 +194,7 @@ func writeCodelab(dir string, clab *types.Codelab, ctx *types.Context) error {
 			w = f
 			defer f.Close()
 		}
-		return render.Execute(w, ctx.Format, data)
+		return render.Execute(w, ctx.Format, data, opt...)
 	}
 	for i, step := range clab.Steps {
 		data.Current = step
@@ -173,7 +214,7 @@ func writeCodelab(dir string, clab *types.Codelab, ctx *types.Context) error {
 			w = f
 			defer f.Close()
 		}
-		if err := render.Execute(w, ctx.Format, data); err != nil {
+		if err := render.Execute(w, ctx.Format, data, opt...); err != nil {
 			return err
 		}
 	}
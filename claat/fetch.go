@@ -15,6 +15,7 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"hash/crc64"
@@ -26,10 +27,13 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/CloudVLab/tools/claat/parser"
+	"github.com/CloudVLab/tools/claat/parser/gdoc"
 	"github.com/CloudVLab/tools/claat/types"
 )
 
@@ -47,6 +51,17 @@ const (
 // srcType is codelab source type
 type srcType string
 
+// regionMarkerRegexp matches comment lines marking the start or end of a code region.
+var regionMarkerRegexp = regexp.MustCompile(`\[(START|END) [^\]]+\]`)
+
+// fragmentExts maps extensions of local fragment files to their source type.
+var fragmentExts = map[string]srcType{
+	".md":       srcMarkdown,
+	".markdown": srcMarkdown,
+	".html":     srcGoogleDoc, // Google Doc exported as HTML
+	".htm":      srcGoogleDoc,
+}
+
 // resource is a codelab resource, loaded from local file
 // or fetched from remote location.
 type resource struct {
@@ -67,57 +82,405 @@ type codelab struct {
 // It returns parsed codelab and its source type.
 //
 // The function will also fetch and parse fragments included
-// with types.ImportNode.
-func slurpCodelab(src string, parseFragments bool) (*codelab, error) {
+// with types.ImportNode, as well as the fragments they import in turn,
+// up to *importDepth levels deep. Warnings found in the fragments are added
+// to the codelab warnings.
+//
+// Google Doc sources and fragments are parsed with the style profile,
+// or the default profile if profile is nil.
+func slurpCodelab(src string, parseFragments bool, profile *gdoc.StyleProfile) (*codelab, error) {
 	res, err := fetch(src)
 	if err != nil {
 		return nil, err
 	}
 	defer res.body.Close()
-	clab, err := parser.Parse(string(res.typ), res.body, parseFragments)
+	p, err := sourceParser(res.typ, profile)
+	if err != nil {
+		return nil, err
+	}
+	clab, err := parser.ParseWith(p, res.body, parseFragments)
 	if err != nil {
 		return nil, err
 	}
 
-	// fetch imports and parse them as fragments
-	var imports []*types.ImportNode
+	// fetch imports and parse them as fragments, recursively
+	if parseFragments {
+		im := newImporter(*importDepth)
+		im.profile = profile
+		loc := remoteLoc(src)
+		if isLocalFile(src) {
+			if loc, err = filepath.Abs(src); err != nil {
+				return nil, err
+			}
+			im.root = filepath.Dir(loc)
+		}
+		warn, err := im.resolve(clab.Steps, []string{loc})
+		if err != nil {
+			return nil, err
+		}
+		clab.Warnings = append(clab.Warnings, warn...)
+	}
+	numberSurveys(clab)
+
+	v := &codelab{
+		Codelab: clab,
+		typ:     res.typ,
+		mod:     res.mod,
+	}
+	return v, nil
+}
+
+// numberSurveys assigns IDs to the surveys of clab, made of the codelab ID
+// and the survey number, so that they are unique in the codelab.
+// Parsers number the surveys of each codelab and fragment on their own,
+// which makes the surveys of imported fragments collide.
+func numberSurveys(clab *types.Codelab) {
+	prefix := clab.ID
+	if prefix == "" {
+		prefix = "survey"
+	}
+	var n int
 	for _, st := range clab.Steps {
+		types.Walk(st.Content.Nodes, func(node types.Node) {
+			if sn, ok := node.(*types.SurveyNode); ok {
+				n++
+				sn.ID = fmt.Sprintf("%s-%d", prefix, n)
+			}
+		})
+	}
+}
+
+// sourceParser returns the parser of codelab sources of type typ.
+// Google Docs are parsed with the style profile, or the default one if profile is nil.
+func sourceParser(typ srcType, profile *gdoc.StyleProfile) (parser.Parser, error) {
+	if typ == srcGoogleDoc {
+		return &gdoc.Parser{Profile: profile}, nil
+	}
+	return parser.Lookup(string(typ))
+}
+
+// readProfile reads a Google Doc style profile from file. It also returns
+// the absolute path of file, to be recorded in the codelab metadata,
+// so that the update command finds it from any directory.
+// It returns nil, meaning the default profile, and an empty path if file is empty.
+func readProfile(file string) (string, *gdoc.StyleProfile, error) {
+	if file == "" {
+		return "", nil, nil
+	}
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return "", nil, err
+	}
+	f, err := os.Open(abs)
+	if err != nil {
+		return "", nil, err
+	}
+	defer f.Close()
+	p, err := gdoc.ReadProfile(f)
+	if err != nil {
+		return "", nil, fmt.Errorf("%s: %v", file, err)
+	}
+	return abs, p, nil
+}
+
+// importer resolves fragment imports of a single codelab.
+// Each unique fragment is fetched only once, even if imported several times.
+//
+// Imports of a local source may refer to local files, relative to the importing
+// source. Such files must be located in root, the directory of the codelab source.
+type importer struct {
+	maxDepth int                // maximum nesting depth of imports
+	root     string             // directory of a local codelab source, or empty
+	profile  *gdoc.StyleProfile // style profile of Google Doc fragments, or nil for the default
+
+	mu   sync.Mutex                 // guards srcs
+	srcs map[string]*fragmentSource // fetched fragments, keyed by location
+}
+
+// fragmentSource is the content of a fragment or an included source file, fetched once.
+type fragmentSource struct {
+	once sync.Once
+	typ  srcType
+	body []byte
+	err  error
+}
+
+// newImporter creates a new importer which allows imports up to maxDepth levels deep.
+func newImporter(maxDepth int) *importer {
+	return &importer{
+		maxDepth: maxDepth,
+		srcs:     make(map[string]*fragmentSource),
+	}
+}
+
+// resolve fetches and parses fragments imported in steps, recursively,
+// and fetches code snippets included in the steps and fragments.
+// The chain argument is the list of source locations leading to steps, starting with the codelab source,
+// as returned by locate.
+// It returns warnings found in the fragments, or the first error encountered.
+func (im *importer) resolve(steps []*types.Step, chain []string) ([]*types.Warning, error) {
+	var imports []*types.ImportNode
+	for _, st := range steps {
+		if err := im.resolveCode(st.Content.Nodes, chain[0]); err != nil {
+			return nil, err
+		}
 		imports = append(imports, importNodes(st.Content.Nodes)...)
 	}
-	ch := make(chan error, len(imports))
+	return im.resolveImports(imports, chain)
+}
+
+// resolveImports fills in the content of imports, including any nested imports.
+// Imports forming a cycle or nested deeper than im.maxDepth result in an error
+// reporting the chain of imports.
+func (im *importer) resolveImports(imports []*types.ImportNode, chain []string) ([]*types.Warning, error) {
+	type result struct {
+		warn []*types.Warning
+		err  error
+	}
+	ch := make(chan *result, len(imports))
 	defer close(ch)
 	for _, imp := range imports {
 		go func(n *types.ImportNode) {
-			frag, err := slurpFragment(n.URL)
-			if err != nil {
-				ch <- fmt.Errorf("%s: %v", n.URL, err)
-				return
-			}
-			n.Content.Nodes = frag
-			ch <- nil
+			warn, err := im.resolveImport(n, chain)
+			ch <- &result{warn, err}
 		}(imp)
 	}
+	var warn []*types.Warning
+	var err error
 	for _ = range imports {
-		if err := <-ch; err != nil {
-			return nil, err
+		res := <-ch
+		if res.err != nil && err == nil {
+			err = res.err
 		}
+		warn = append(warn, res.warn...)
 	}
-
-	v := &codelab{
-		Codelab: clab,
-		typ:     res.typ,
-		mod:     res.mod,
+	if err != nil {
+		return nil, err
 	}
-	return v, nil
+	return warn, nil
 }
 
-func slurpFragment(url string) ([]types.Node, error) {
-	res, err := fetchRemote(url, true)
+// resolveImport fetches and parses the fragment imported by n, recursively.
+func (im *importer) resolveImport(n *types.ImportNode, chain []string) ([]*types.Warning, error) {
+	loc, local, err := im.locate(n.URL, chain[len(chain)-1])
 	if err != nil {
+		return nil, fmt.Errorf("%s: %v", n.URL, err)
+	}
+	next := append(chain[:len(chain):len(chain)], loc)
+	for _, u := range chain {
+		if u == loc {
+			return nil, fmt.Errorf("import cycle: %s", strings.Join(next, " -> "))
+		}
+	}
+	if len(chain) > im.maxDepth {
+		return nil, fmt.Errorf("imports nested more than %d levels deep: %s", im.maxDepth, strings.Join(next, " -> "))
+	}
+	frag, warn, err := im.slurpFragment(loc, local)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", n.URL, err)
+	}
+	n.Content.Nodes = frag
+	if err := im.resolveCode(frag, loc); err != nil {
 		return nil, err
 	}
-	defer res.body.Close()
-	return parser.ParseFragment(string(res.typ), res.body, true)
+	nested, err := im.resolveImports(importNodes(frag), next)
+	if err != nil {
+		return nil, err
+	}
+	return append(warn, nested...), nil
+}
+
+// resolveCode fetches the content of code snippets included in nodes from external sources.
+// The location of a snippet source is relative to parent, the source of nodes.
+// Content of imported fragments is not visited.
+func (im *importer) resolveCode(nodes []types.Node, parent string) error {
+	var err error
+	types.Walk(nodes, func(n types.Node) {
+		cn, ok := n.(*types.CodeNode)
+		if !ok || cn.Include == nil || err != nil {
+			return
+		}
+		loc, local, e := im.locate(cn.Include.URL, parent)
+		if e == nil {
+			var b []byte
+			if _, b, e = im.fetch(loc, local); e == nil {
+				cn.Value, e = selectCode(string(b), cn.Include)
+			}
+		}
+		if e != nil {
+			err = fmt.Errorf("%s: %v", cn.Include.URL, e)
+		}
+	})
+	return err
+}
+
+// selectCode returns the part of source src selected by inc: either its line range,
+// or the lines of its region, without the marker comments of any region.
+// The selected lines are unindented by their common indentation.
+func selectCode(src string, inc *types.CodeInclude) (string, error) {
+	lines := strings.Split(strings.TrimRight(src, "\n"), "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimRight(l, "\r")
+	}
+	switch {
+	case inc.Region != "":
+		start, end := -1, -1
+		for i, l := range lines {
+			if start < 0 && strings.Contains(l, "[START "+inc.Region+"]") {
+				start = i + 1
+			} else if start >= 0 && strings.Contains(l, "[END "+inc.Region+"]") {
+				end = i
+				break
+			}
+		}
+		if start < 0 || end < 0 {
+			return "", fmt.Errorf("region %q not found", inc.Region)
+		}
+		lines = lines[start:end]
+	case inc.Start > 0:
+		if inc.Start > len(lines) {
+			return "", fmt.Errorf("line %d is past the end of the file", inc.Start)
+		}
+		end := inc.End
+		if end == 0 || end > len(lines) {
+			end = len(lines)
+		}
+		lines = lines[inc.Start-1 : end]
+	}
+
+	var code []string
+	indent := -1
+	for _, l := range lines {
+		if regionMarkerRegexp.MatchString(l) {
+			continue
+		}
+		code = append(code, l)
+		if strings.TrimSpace(l) == "" {
+			continue
+		}
+		if n := len(l) - len(strings.TrimLeft(l, " \t")); indent < 0 || n < indent {
+			indent = n
+		}
+	}
+	for i, l := range code {
+		if strings.TrimSpace(l) == "" {
+			code[i] = ""
+		} else if indent > 0 {
+			code[i] = l[indent:]
+		}
+	}
+	return strings.Join(code, "\n") + "\n", nil
+}
+
+// locate returns the location of fragment or source file ref referenced by parent.
+// A ref without a scheme or host, which looks like a file path rather than
+// a Google Doc ID, is a local file if parent is a local file too. In that case
+// the returned location is the absolute path of the file, and local is true.
+// Otherwise, it is the location returned by remoteLoc.
+// A file path referenced by a remote parent is an error, since there is
+// no local directory to resolve it against.
+func (im *importer) locate(ref, parent string) (loc string, local bool, err error) {
+	u, err := url.Parse(ref)
+	if err != nil {
+		return "", false, err
+	}
+	if u.Scheme != "" || u.Host != "" || !strings.ContainsAny(ref, "/.") {
+		return remoteLoc(ref), false, nil
+	}
+	if im.root == "" || !isLocalFile(parent) {
+		return "", false, fmt.Errorf("file path in remote source %s; use a full URL instead", parent)
+	}
+	p := filepath.FromSlash(u.Path)
+	if !filepath.IsAbs(p) {
+		dir, err := filepath.Abs(filepath.Dir(parent))
+		if err != nil {
+			return "", false, err
+		}
+		p = filepath.Join(dir, p)
+	}
+	p, err = restrictPathToParent(p, im.root)
+	return p, true, err
+}
+
+// remoteLoc returns the location of remote source ref: the ID of a Google Doc,
+// whether ref is the ID or a URL of the doc, or ref itself for other sources.
+// This way, all references to the same doc share the same location.
+func remoteLoc(ref string) string {
+	u, err := url.Parse(ref)
+	if err != nil || (u.Host != "" && u.Host != "docs.google.com") {
+		return ref
+	}
+	return gdocID(ref)
+}
+
+// fetch retrieves the content located at loc, either from local disk or a remote location.
+// The content is fetched only the first time. The source type of a local file is chosen
+// by its extension, and is srcInvalid if the extension is unknown.
+func (im *importer) fetch(loc string, local bool) (srcType, []byte, error) {
+	im.mu.Lock()
+	src, ok := im.srcs[loc]
+	if !ok {
+		src = &fragmentSource{}
+		im.srcs[loc] = src
+	}
+	im.mu.Unlock()
+	src.once.Do(func() {
+		if local {
+			src.typ = fragmentExts[strings.ToLower(filepath.Ext(loc))]
+			src.body, src.err = ioutil.ReadFile(loc)
+			return
+		}
+		res, err := fetchRemote(loc, true)
+		if err != nil {
+			src.err = err
+			return
+		}
+		defer res.body.Close()
+		src.typ = res.typ
+		src.body, src.err = ioutil.ReadAll(res.body)
+	})
+	return src.typ, src.body, src.err
+}
+
+// slurpFragment retrieves and parses a codelab fragment located at loc,
+// using the parser of the fragment's source type. A local fragment is read from disk,
+// and its source type is chosen by the file extension. The fragment is fetched
+// only the first time; every call parses it anew, so that the returned nodes
+// are never shared.
+// Positions of the fragment nodes and warnings refer to loc.
+func (im *importer) slurpFragment(loc string, local bool) ([]types.Node, []*types.Warning, error) {
+	typ, body, err := im.fetch(loc, local)
+	if err != nil {
+		return nil, nil, err
+	}
+	if typ == srcInvalid {
+		return nil, nil, fmt.Errorf("unsupported fragment file type %q", filepath.Ext(loc))
+	}
+
+	p, err := sourceParser(typ, im.profile)
+	if err != nil {
+		return nil, nil, err
+	}
+	nodes, warn, err := p.ParseFragment(bytes.NewReader(body), true)
+	if err != nil {
+		return nil, nil, err
+	}
+	types.Walk(nodes, func(n types.Node) {
+		if p := n.Pos(); p.IsValid() {
+			p.File = loc
+			n.MutatePos(p)
+		}
+	})
+	for _, w := range warn {
+		w.Pos.File = loc
+	}
+	return nodes, warn, nil
+}
+
+// isLocalFile reports whether name is a file on local disk.
+func isLocalFile(name string) bool {
+	fi, err := os.Stat(name)
+	return err == nil && !fi.IsDir()
 }
 
 // fetch retrieves codelab doc either from local disk
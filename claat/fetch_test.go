@@ -20,8 +20,11 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
+	"sync"
 	"testing"
 	"testing/quick"
 
@@ -135,7 +138,7 @@ func TestSlurpWithFragment(t *testing.T) {
 	}}
 	clients[providerGoogle] = &http.Client{Transport: rt}
 
-	clab, err := slurpCodelab("doc-123", true)
+	clab, err := slurpCodelab("doc-123", true, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -161,6 +164,380 @@ func TestSlurpWithFragment(t *testing.T) {
 	}
 }
 
+func TestSlurpMarkdownWithFragment(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/codelab.md":
+			fmt.Fprintf(w, "id: md-import\n\n# Title\n\n## Step\n\n[[**import** [shared](http://%s/shared.md)]]\n", r.Host)
+		case "/shared.md":
+			w.Write([]byte("I'm imported from elsewhere.\n\n[[**unknown** [x](http://example.com)]]\n"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	clab, err := slurpCodelab(ts.URL+"/codelab.md", true, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	imports := importNodes(clab.Steps[0].Content.Nodes)
+	if len(imports) != 1 {
+		t.Fatalf("importNodes: %d; want 1", len(imports))
+	}
+	html, err := render.HTML("", imports[0].Content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "imported from elsewhere"
+	if !strings.Contains(string(html), want) {
+		t.Errorf("%s does not contain %q", html, want)
+	}
+	if pos, want := clab.Steps[0].Pos, (types.Pos{Line: 5, Col: 4}); pos != want {
+		t.Errorf("step pos = %v; want %v", pos, want)
+	}
+	frag := imports[0].Content.Nodes
+	if len(frag) == 0 {
+		t.Fatal("no imported nodes")
+	}
+	if pos, want := frag[0].Pos(), (types.Pos{File: ts.URL + "/shared.md", Line: 1, Col: 1}); pos != want {
+		t.Errorf("imported node pos = %v; want %v", pos, want)
+	}
+	if len(clab.Warnings) != 1 {
+		t.Fatalf("clab.Warnings = %v; want 1 warning", clab.Warnings)
+	}
+	if w, want := clab.Warnings[0].String(), ts.URL+"/shared.md:3:5: unknown directive [[unknown]]"; w != want {
+		t.Errorf("warning = %q; want %q", w, want)
+	}
+}
+
+func TestSlurpNestedImports(t *testing.T) {
+	var mu sync.Mutex
+	fetched := make(map[string]int)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		fetched[r.URL.Path]++
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/codelab.md":
+			fmt.Fprintf(w, "id: nested\n\n# Title\n\n"+
+				"## One\n\n[[**import** [a](http://%[1]s/a.md)]]\n\n"+
+				"## Two\n\n[[**import** [a](http://%[1]s/a.md)]]\n", r.Host)
+		case "/a.md":
+			fmt.Fprintf(w, "Outer fragment.\n\n[[**import** [b](http://%s/b.md)]]\n", r.Host)
+		case "/b.md":
+			w.Write([]byte("Inner fragment."))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	clab, err := slurpCodelab(ts.URL+"/codelab.md", true, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, st := range clab.Steps {
+		outer := importNodes(st.Content.Nodes)
+		if len(outer) != 1 {
+			t.Fatalf("%d: importNodes: %d; want 1", i, len(outer))
+		}
+		inner := importNodes(outer[0].Content.Nodes)
+		if len(inner) != 1 {
+			t.Fatalf("%d: nested importNodes: %d; want 1", i, len(inner))
+		}
+		html, err := render.HTML("", inner[0].Content)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(html), "Inner fragment.") {
+			t.Errorf("%d: %s does not contain the inner fragment", i, html)
+		}
+	}
+	if outer := importNodes(clab.Steps[0].Content.Nodes)[0]; outer == importNodes(clab.Steps[1].Content.Nodes)[0] {
+		t.Error("steps share the same import node")
+	}
+	for _, p := range []string{"/a.md", "/b.md"} {
+		if fetched[p] != 1 {
+			t.Errorf("%s fetched %d times; want 1", p, fetched[p])
+		}
+	}
+}
+
+func TestSlurpImportErrors(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/codelab.md":
+			fmt.Fprintf(w, "id: cycle\n\n# Title\n\n## Step\n\n[[**import** [a](http://%s/a.md)]]\n", r.Host)
+		case "/a.md":
+			fmt.Fprintf(w, "[[**import** [b](http://%s/b.md)]]\n", r.Host)
+		case "/b.md":
+			fmt.Fprintf(w, "[[**import** [a](http://%s/a.md)]]\n", r.Host)
+		case "/relative.md":
+			w.Write([]byte("id: relative\n\n# Title\n\n## Step\n\n[[**import** [a](fragments/a.md)]]\n"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	src := ts.URL + "/codelab.md"
+	_, err := slurpCodelab(src, true, nil)
+	want := "import cycle: " + src + " -> " + ts.URL + "/a.md -> " + ts.URL + "/b.md -> " + ts.URL + "/a.md"
+	if err == nil || err.Error() != want {
+		t.Errorf("slurpCodelab err = %v; want %q", err, want)
+	}
+
+	rel := ts.URL + "/relative.md"
+	_, err = slurpCodelab(rel, true, nil)
+	want = "fragments/a.md: file path in remote source " + rel + "; use a full URL instead"
+	if err == nil || err.Error() != want {
+		t.Errorf("slurpCodelab err = %v; want %q", err, want)
+	}
+
+	defer func(d int) { *importDepth = d }(*importDepth)
+	*importDepth = 1
+	_, err = slurpCodelab(src, true, nil)
+	want = "imports nested more than 1 levels deep: " + src + " -> " + ts.URL + "/a.md -> " + ts.URL + "/b.md"
+	if err == nil || err.Error() != want {
+		t.Errorf("slurpCodelab err = %v; want %q", err, want)
+	}
+}
+
+func TestSlurpSurveyIDs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "claat-survey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	const survey = "Survey\n: Did it work?\n    * Yes\n    * No\n"
+	files := map[string]string{
+		"codelab.md": "id: surveys\n\n# Title\n\n## Step\n\n" + survey + "\n" +
+			"[[**import** [a](a.md)]]\n\n[[**import** [b](b.md)]]\n",
+		"a.md": survey,
+		"b.md": survey,
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	clab, err := slurpCodelab(filepath.Join(dir, "codelab.md"), true, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	types.Walk(clab.Steps[0].Content.Nodes, func(n types.Node) {
+		if sn, ok := n.(*types.SurveyNode); ok {
+			ids = append(ids, sn.ID)
+		}
+	})
+	if want := []string{"surveys-1", "surveys-2", "surveys-3"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("survey IDs = %q; want %q", ids, want)
+	}
+}
+
+func TestSlurpLocalImports(t *testing.T) {
+	dir, err := ioutil.TempDir("", "claat-import")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"codelab.md":          "id: local\n\n# Title\n\n## Step\n\n[[**import** [setup](fragments/setup.md)]]\n",
+		"fragments/setup.md":  "Set up the project.\n\n[[**import** [common](common.md)]]\n",
+		"fragments/common.md": "Common instructions.\n",
+		"outside.md":          "id: outside\n\n# Title\n\n## Step\n\n[[**import** [secret](../secret.md)]]\n",
+		"unknown.md":          "id: unknown\n\n# Title\n\n## Step\n\n[[**import** [text](fragments/notes.txt)]]\n",
+	}
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	clab, err := slurpCodelab(filepath.Join(dir, "codelab.md"), true, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outer := importNodes(clab.Steps[0].Content.Nodes)
+	if len(outer) != 1 {
+		t.Fatalf("importNodes: %d; want 1", len(outer))
+	}
+	inner := importNodes(outer[0].Content.Nodes)
+	if len(inner) != 1 {
+		t.Fatalf("nested importNodes: %d; want 1", len(inner))
+	}
+	html, err := render.HTML("", outer[0].Content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Set up the project.", "Common instructions."} {
+		if !strings.Contains(string(html), want) {
+			t.Errorf("%s does not contain %q", html, want)
+		}
+	}
+	abs, err := filepath.Abs(filepath.Join(dir, "fragments", "common.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pos := inner[0].Content.Nodes[0].Pos(); pos.File != abs {
+		t.Errorf("imported node file = %q; want %q", pos.File, abs)
+	}
+
+	for _, name := range []string{"outside.md", "unknown.md"} {
+		if _, err := slurpCodelab(filepath.Join(dir, name), true, nil); err == nil {
+			t.Errorf("slurpCodelab(%s) returned no error", name)
+		}
+	}
+}
+
+func TestSlurpRootImportCycle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "claat-cycle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"codelab.md":     "id: cycle\n\n# Title\n\n## Step\n\n[[**import** [a](fragments/a.md)]]\n",
+		"fragments/a.md": "[[**import** [codelab](../codelab.md)]]\n",
+	}
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	root, err := filepath.Abs("codelab.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = slurpCodelab("codelab.md", true, nil)
+	want := "import cycle: " + root + " -> " + filepath.Join(filepath.Dir(root), "fragments", "a.md") + " -> " + root
+	if err == nil || err.Error() != want {
+		t.Errorf("slurpCodelab err = %v; want %q", err, want)
+	}
+}
+
+func TestRemoteLoc(t *testing.T) {
+	tests := []struct{ in, out string }{
+		{"1AbC", "1AbC"},
+		{"https://docs.google.com/document/d/1AbC/edit", "1AbC"},
+		{"https://docs.google.com/document/d/1AbC", "1AbC"},
+		{"https://example.com/document/d/1AbC/a.md", "https://example.com/document/d/1AbC/a.md"},
+	}
+	for _, tc := range tests {
+		if out := remoteLoc(tc.in); out != tc.out {
+			t.Errorf("remoteLoc(%q) = %q; want %q", tc.in, out, tc.out)
+		}
+	}
+}
+
+func TestSelectCode(t *testing.T) {
+	const src = "package main\n" +
+		"\n" +
+		"func main() {\n" +
+		"\t// [START hello]\n" +
+		"\tfmt.Println(\"hello\")\n" +
+		"\n" +
+		"\t// [START inner]\n" +
+		"\tfmt.Println(\"world\")\n" +
+		"\t// [END inner]\n" +
+		"\t// [END hello]\n" +
+		"}\n"
+	tests := []struct {
+		inc *types.CodeInclude
+		out string
+	}{
+		{&types.CodeInclude{}, "package main\n\nfunc main() {\n\tfmt.Println(\"hello\")\n\n\tfmt.Println(\"world\")\n}\n"},
+		{&types.CodeInclude{Start: 3, End: 3}, "func main() {\n"},
+		{&types.CodeInclude{Start: 10}, "}\n"},
+		{&types.CodeInclude{Start: 5, End: 100}, "\tfmt.Println(\"hello\")\n\n\tfmt.Println(\"world\")\n}\n"},
+		{&types.CodeInclude{Region: "hello"}, "fmt.Println(\"hello\")\n\nfmt.Println(\"world\")\n"},
+		{&types.CodeInclude{Region: "inner"}, "fmt.Println(\"world\")\n"},
+	}
+	for i, tc := range tests {
+		out, err := selectCode(src, tc.inc)
+		if err != nil {
+			t.Errorf("%d: %v", i, err)
+			continue
+		}
+		if out != tc.out {
+			t.Errorf("%d: selectCode = %q; want %q", i, out, tc.out)
+		}
+	}
+	for _, inc := range []*types.CodeInclude{{Region: "missing"}, {Start: 20}} {
+		if _, err := selectCode(src, inc); err == nil {
+			t.Errorf("selectCode(%+v): no error", inc)
+		}
+	}
+}
+
+func TestSlurpCodeInclude(t *testing.T) {
+	dir, err := ioutil.TempDir("", "claat-code")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"codelab.md": "id: code\n\n# Title\n\n## Step\n\n" +
+			"[[**code** [main.go](samples/main.go) 2-3]]\n\n" +
+			"[[**import** [fragment](fragments/frag.md)]]\n",
+		"fragments/frag.md": "[[**code** [app.py](app.py) greet]]\n",
+		"fragments/app.py":  "# [START greet]\nprint('hi')\n# [END greet]\n",
+		"samples/main.go":   "package main\n\nfunc main() {}\n",
+	}
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	clab, err := slurpCodelab(filepath.Join(dir, "codelab.md"), true, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var code []*types.CodeNode
+	types.Walk(clab.Steps[0].Content.Nodes, func(n types.Node) {
+		if cn, ok := n.(*types.CodeNode); ok {
+			code = append(code, cn)
+		}
+	})
+	if len(code) != 2 {
+		t.Fatalf("found %d code nodes; want 2", len(code))
+	}
+	want := []struct{ lang, value string }{
+		{"go", "\nfunc main() {}\n"},
+		{"python", "print('hi')\n"},
+	}
+	for i, cn := range code {
+		if cn.Lang != want[i].lang || cn.Value != want[i].value {
+			t.Errorf("%d: code = %q, %q; want %q, %q", i, cn.Lang, cn.Value, want[i].lang, want[i].value)
+		}
+	}
+}
+
 func TestGdocID(t *testing.T) {
 	tests := []struct{ in, out string }{
 		{"https://docs.google.com/document/d/foo", "foo"},
@@ -242,3 +619,61 @@ func safeAbs(t *testing.T, p string) string {
 	}
 	return p
 }
+
+func TestSlurpStyleProfile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "claat-style")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"style.json":   `{"code_font": "Roboto Mono"}`,
+		"codelab.md":   "id: style\n\n# Title\n\n## Step\n\n[[**import** [setup](setup.html)]]\n",
+		"setup.html":   `<html><head><style>.c1 { font-family: "Roboto Mono" }</style></head><body><p><span class="c1">make</span></p></body></html>`,
+		"invalid.json": `{"code_fonts": "Roboto Mono"}`,
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	style, profile, err := readProfile(filepath.Join(dir, "style.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !filepath.IsAbs(style) {
+		t.Errorf("readProfile: path %q is not absolute", style)
+	}
+	clab, err := slurpCodelab(filepath.Join(dir, "codelab.md"), true, profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	imports := importNodes(clab.Steps[0].Content.Nodes)
+	if len(imports) != 1 {
+		t.Fatalf("importNodes: %d; want 1", len(imports))
+	}
+	want := "<p><code>make</code></p>\n"
+	if h, _ := render.HTML("", imports[0].Content.Nodes...); string(h) != want {
+		t.Errorf("fragment = %q; want %q", h, want)
+	}
+
+	if style, p, err := readProfile(""); style != "" || p != nil || err != nil {
+		t.Errorf("readProfile(\"\") = %q, %v, %v; want \"\", nil, nil", style, p, err)
+	}
+	if _, _, err := readProfile(filepath.Join(dir, "invalid.json")); err == nil {
+		t.Error("readProfile(invalid.json) returned no error")
+	}
+}
+
+func TestHighlightTheme(t *testing.T) {
+	if th, err := highlightTheme(""); th != nil || err != nil {
+		t.Errorf("highlightTheme(\"\") = %v, %v; want nil, nil", th, err)
+	}
+	if th, err := highlightTheme("Dark"); th == nil || err != nil {
+		t.Errorf("highlightTheme(Dark) = %v, %v; want the dark theme", th, err)
+	}
+	if _, err := highlightTheme("solarized"); err == nil {
+		t.Error("highlightTheme(solarized) returned no error")
+	}
+}
@@ -0,0 +1,184 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/CloudVLab/tools/claat/parser"
+	"github.com/CloudVLab/tools/claat/types"
+)
+
+// knownStatus contains valid codelab status values.
+var knownStatus = map[string]bool{
+	"draft":      true,
+	"published":  true,
+	"deprecated": true,
+	"hidden":     true,
+}
+
+// lintProblem is a single problem found in a codelab.
+type lintProblem struct {
+	sev  types.Severity // types.SeverityError makes lint fail
+	step *types.Step    // step the problem is found in, or nil for codelab-wide problems
+	num  int            // 1-based step number
+	pos  types.Pos      // source position of the problem, if known
+	msg  string
+}
+
+// String formats p as "pos: step N "title": msg".
+// Unknown parts of the location are omitted.
+func (p *lintProblem) String() string {
+	s := p.msg
+	if p.step != nil {
+		s = fmt.Sprintf("step %d %q: %s", p.num, p.step.Title, s)
+	}
+	if p.pos.IsValid() {
+		s = p.pos.String() + ": " + s
+	}
+	return s
+}
+
+// cmdLint is the "claat lint ..." subcommand.
+func cmdLint() {
+	if flag.NArg() == 0 {
+		fatalf("Need at least one source. Try '-h' for options.")
+	}
+	_, profile, err := readProfile(*styleFile)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	type result struct {
+		src  string
+		warn []*types.Warning
+		prob []*lintProblem
+		err  error
+	}
+	args := unique(flag.Args())
+	ch := make(chan *result, len(args))
+	for _, src := range args {
+		go func(src string) {
+			clab, err := slurpCodelab(src, !*skipFragments, profile)
+			if err != nil {
+				ch <- &result{src: src, err: err}
+				return
+			}
+			ch <- &result{src: src, warn: clab.Warnings, prob: lintCodelab(clab.Codelab)}
+		}(src)
+	}
+	for _ = range args {
+		res := <-ch
+		if res.err != nil {
+			errorf(reportErr, res.src, res.err)
+			continue
+		}
+		// parser warnings come first, as they may explain some of the problems
+		printWarnings(res.src, res.warn)
+		var failed bool
+		for _, w := range res.warn {
+			failed = failed || w.Severity == types.SeverityError
+		}
+		for _, p := range res.prob {
+			printf("%s\t%s %s", p.sev, res.src, p)
+			failed = failed || p.sev == types.SeverityError
+		}
+		if failed {
+			errorf(reportErr, res.src, "lint failed")
+		} else {
+			printf(reportOk, res.src)
+		}
+	}
+}
+
+// lintCodelab validates codelab c and returns all the problems it finds,
+// codelab-wide problems first, followed by problems of each step in order.
+func lintCodelab(c *types.Codelab) []*lintProblem {
+	var prob []*lintProblem
+	add := func(sev types.Severity, step *types.Step, num int, format string, args ...interface{}) *lintProblem {
+		p := &lintProblem{sev: sev, step: step, num: num, msg: fmt.Sprintf(format, args...)}
+		if step != nil {
+			p.pos = step.Pos
+		}
+		prob = append(prob, p)
+		return p
+	}
+
+	// metadata
+	if c.ID == "" || derivedID(c) {
+		add(types.SeverityError, nil, 0, "missing codelab ID")
+	}
+	if c.Title == "" {
+		add(types.SeverityError, nil, 0, "missing codelab title")
+	}
+	if c.Summary == "" {
+		add(types.SeverityWarning, nil, 0, "missing summary")
+	}
+	if len(c.Categories) == 0 {
+		add(types.SeverityWarning, nil, 0, "missing categories")
+	}
+	if c.Status == nil || len(*c.Status) == 0 {
+		add(types.SeverityWarning, nil, 0, "missing status")
+	} else {
+		for _, s := range *c.Status {
+			if !knownStatus[strings.ToLower(s)] {
+				add(types.SeverityError, nil, 0, "unknown status %q", s)
+			}
+		}
+	}
+	if len(c.Steps) == 0 {
+		add(types.SeverityError, nil, 0, "no steps")
+	}
+
+	// steps
+	seen := make(map[string]int, len(c.Steps))
+	for i, st := range c.Steps {
+		num := i + 1
+		key := strings.ToLower(strings.TrimSpace(st.Title))
+		if key == "" {
+			add(types.SeverityError, st, num, "missing step title")
+		} else if n, ok := seen[key]; ok {
+			add(types.SeverityError, st, num, "duplicate step title, same as step %d", n)
+		} else {
+			seen[key] = num
+		}
+		if st.Content.Empty() {
+			add(types.SeverityError, st, num, "empty step")
+		}
+		if st.Duration == 0 {
+			add(types.SeverityWarning, st, num, "zero duration")
+		}
+		for _, img := range imageNodes(st.Content.Nodes) {
+			if strings.TrimSpace(img.Alt) == "" {
+				p := add(types.SeverityWarning, st, num, "image %s without alt text", img.Src)
+				if img.Pos().IsValid() {
+					p.pos = img.Pos()
+				}
+			}
+		}
+	}
+	return prob
+}
+
+// derivedID reports whether the parser derived the ID of c from its title.
+func derivedID(c *types.Codelab) bool {
+	for _, w := range c.Warnings {
+		if w.Msg == parser.MsgDerivedID {
+			return true
+		}
+	}
+	return false
+}
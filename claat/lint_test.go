@@ -0,0 +1,75 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CloudVLab/tools/claat/parser"
+	"github.com/CloudVLab/tools/claat/types"
+)
+
+func TestLintCodelab(t *testing.T) {
+	status := types.LegacyStatus{"draft", "final"}
+	clab := &types.Codelab{Meta: types.Meta{
+		Title:  "Title",
+		Status: &status,
+	}}
+	st := clab.NewStep("Setup")
+	st.Duration = 5 * time.Minute
+	st.Content.Append(types.NewTextNode("text"))
+	clab.NewStep("Empty")
+	st = clab.NewStep("setup")
+	st.Duration = 5 * time.Minute
+	img := types.NewImageNode("a.png")
+	img.Alt = "described"
+	st.Content.Append(types.NewListNode(img, types.NewImageNode("b.png")))
+
+	var out []string
+	for _, p := range lintCodelab(clab) {
+		out = append(out, p.sev.String()+" "+p.String())
+	}
+	want := []string{
+		`err missing codelab ID`,
+		`warn missing summary`,
+		`warn missing categories`,
+		`err unknown status "final"`,
+		`err step 2 "Empty": empty step`,
+		`warn step 2 "Empty": zero duration`,
+		`err step 3 "setup": duplicate step title, same as step 1`,
+		`warn step 3 "setup": image b.png without alt text`,
+	}
+	if !reflect.DeepEqual(out, want) {
+		t.Errorf("lintCodelab:\n%q\nwant:\n%q", out, want)
+	}
+}
+
+func TestLintDerivedID(t *testing.T) {
+	const markup = `<html><body><p class="title"><span>My Codelab</span></p><h1>Setup</h1><p>text</p></body></html>`
+	clab, err := parser.Parse("gdoc", strings.NewReader(markup), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if clab.ID != "my-codelab" {
+		t.Fatalf("clab.ID = %q; want my-codelab", clab.ID)
+	}
+	prob := lintCodelab(clab)
+	if len(prob) == 0 || prob[0].String() != "missing codelab ID" {
+		t.Errorf("lintCodelab = %v; want missing codelab ID first", prob)
+	}
+}
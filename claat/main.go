@@ -29,6 +29,8 @@ import (
 	"sync"
 	"time"
 
+	"github.com/CloudVLab/tools/claat/types"
+
 	// allow parsers to register themselves
 	_ "github.com/CloudVLab/tools/claat/parser/gdoc"
 	_ "github.com/CloudVLab/tools/claat/parser/md"
@@ -43,7 +45,10 @@ var (
 	globalGA      = flag.String("ga", "UA-49880327-14", "global Google Analytics account")
 	extra         = flag.String("extra", "", "Additional arguments to pass to format templates. JSON object of string,string key values.")
 	skipFragments = flag.Bool("skip-fragments", false, "Don't attempt to parse fragment imports.")
+	importDepth   = flag.Int("import-depth", 5, "Maximum nesting depth of fragment imports.")
 	addr          = flag.String("addr", "localhost:9090", "hostname and port to bind web server to")
+	styleFile     = flag.String("style", "", "Google Doc style profile file; built-in profile if empty")
+	highlight     = flag.String("highlight", "", "theme of code highlighted server-side in html and offline formats: light or dark; none if empty")
 
 	version string // set by linker -X
 )
@@ -58,14 +63,16 @@ const (
 	stdout = "-"
 
 	// log report formats
-	reportErr = "err\t%s %v"
-	reportOk  = "ok\t%s"
+	reportErr  = "err\t%s %v"
+	reportOk   = "ok\t%s"
+	reportWarn = "%s\t%s %v" // severity, source and warning
 )
 
 var (
 	// commands contains all valid subcommands, e.g. "claat export".
 	commands = map[string]func(){
 		"export":  cmdExport,
+		"lint":    cmdLint,
 		"serve":   cmdServe,
 		"update":  cmdUpdate,
 		"help":    usage,
@@ -102,6 +109,14 @@ func fatalf(format string, args ...interface{}) {
 	os.Exit(1)
 }
 
+// printWarnings prints parser warnings found in codelab src, one per line.
+// Warnings do not affect the exit code.
+func printWarnings(src string, warn []*types.Warning) {
+	for _, w := range warn {
+		printf(reportWarn, w.Severity, src, w)
+	}
+}
+
 // parseExtraVars parses extra template variables from command line.
 func parseExtraVars() map[string]string {
 	vars := make(map[string]string)
@@ -146,7 +161,7 @@ func usage() {
 
 const usageText = `Usage: claat <cmd> [options] src [src ...]
 
-Available commands are: export, serve, update, version.
+Available commands are: export, lint, serve, update, version.
 
 ## Export command
 
@@ -175,8 +190,63 @@ Instead of writing to an output directory, use "-o -" to specify
 stdout. In this case images and metadata are not exported.
 When writing to a directory, existing files will be overwritten.
 
+Fragments imported with an [[import]] directive may import other
+fragments in turn, up to -import-depth levels deep. Import cycles are
+reported as errors.
+
+Google Docs are parsed following the style conventions of the
+codelab doc template: fonts of code blocks and console commands,
+and background colors of info boxes, surveys, buttons, placeholder
+values and user interface labels. A doc template with other
+conventions is supported with a -style profile, a JSON file
+overriding some or all of the built-in values, e.g.
+
+  {"code_font": "Roboto Mono", "placeholder_color": "#fce5cd"}
+
+The keys are meta_color, button_color, code_font, console_font,
+positive_color, negative_color, survey_color, placeholder_color
+and ui_color. The profile file is recorded in the codelab metadata
+and used again by the update command. In Markdown, placeholder values
+and interface labels are written as [PROJECT_ID]{.placeholder} or
+[Save]{.ui}.
+
+The code language of a Google Doc code block is set with a step
+instruction right before it, such as "Language: go" written in the
+meta_color. Otherwise, the language is guessed from the code itself.
+
+Content which the parser had to drop or could not fully understand,
+such as an unknown [[directive]], is reported as a warning along with
+its location in the source. Warnings do not stop the export.
+
+Code blocks of the html and offline formats are highlighted in the
+browser with JavaScript. Use -highlight with a theme name, "light" or
+"dark", to highlight them at export time instead, with inline styles
+which need no JavaScript or stylesheet, e.g. for offline reading or
+email. The code language is that of the code block, and code of an
+unknown language is not highlighted.
+
 The program exits with non-zero code if at least one src could not be exported.
 
+## Lint command
+
+Lint takes one or more 'src' documents, the same as the export command,
+and checks them for common problems without exporting anything.
+
+Each problem is reported along with the step it is found in,
+as either an error or a warning:
+
+- missing codelab ID or title (error)
+- unknown status value (error)
+- duplicate step titles and empty steps (error)
+- missing summary, categories or status (warning)
+- steps without a duration (warning)
+- images without alt text (warning)
+
+Parser warnings are reported as well, the same as with export.
+
+The program exits with non-zero code if at least one src could not be
+fetched or has errors.
+
 ## Serve command
 
 Serve provides a simple web server for viewing exported codelabs.
@@ -204,8 +274,10 @@ In the latter case, where codelab ID has changed, the new directory
 will be placed alongside the old one. In other words, it will have the same ancestor
 as the old one.
 
-While -prefix and -ga can override existing codelab metadata, the other
-arguments have no effect during update.
+While -prefix, -ga, -style and -highlight can override existing codelab metadata,
+the other arguments have no effect during update.
+
+Parser warnings are reported the same as with export.
 
 The program does not follow symbolic links and exits with non-zero code
 if no metadata found or at least one src could not be updated.
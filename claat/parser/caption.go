@@ -0,0 +1,58 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parser
+
+import (
+	"strings"
+
+	"github.com/CloudVLab/tools/claat/types"
+)
+
+// ImageCaption checks whether nodes are an image followed by a caption,
+// which is a line of text in italics, e.g.
+//
+//	![Cloud Shell](img/shell.png)
+//	*The Cloud Shell button*
+//
+// It returns the image and its caption text, or nil if nodes are not a captioned image.
+// Blank text nodes, such as line breaks, may separate the image from the caption.
+func ImageCaption(nodes []types.Node) (*types.ImageNode, string) {
+	if len(nodes) < 2 {
+		return nil, ""
+	}
+	img, ok := nodes[0].(*types.ImageNode)
+	if !ok {
+		return nil, ""
+	}
+	var caption []string
+	for _, n := range nodes[1:] {
+		t, ok := n.(*types.TextNode)
+		if !ok {
+			return nil, ""
+		}
+		if len(caption) == 0 && strings.TrimSpace(t.Value) == "" {
+			continue
+		}
+		if !t.Italic || t.Bold || t.Code {
+			return nil, ""
+		}
+		caption = append(caption, t.Value)
+	}
+	s := strings.Join(strings.Fields(strings.Join(caption, "")), " ")
+	if s == "" {
+		return nil, ""
+	}
+	return img, s
+}
@@ -0,0 +1,53 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parser
+
+import (
+	"testing"
+
+	"github.com/CloudVLab/tools/claat/types"
+)
+
+func TestImageCaption(t *testing.T) {
+	italic := func(s string) types.Node {
+		n := types.NewTextNode(s)
+		n.Italic = true
+		return n
+	}
+	img := types.NewImageNode("shell.png")
+	tests := []struct {
+		in      []types.Node
+		caption string
+	}{
+		{[]types.Node{img, types.NewTextNode("\n"), italic("The Cloud "), italic("Shell\nbutton ")}, "The Cloud Shell button"},
+		{[]types.Node{img, italic("Figure 1")}, "Figure 1"},
+		// not captions
+		{[]types.Node{img}, ""},
+		{[]types.Node{img, types.NewTextNode("\n")}, ""},
+		{[]types.Node{img, types.NewTextNode(" text")}, ""},
+		{[]types.Node{img, italic("Figure"), types.NewTextNode(" 1")}, ""},
+		{[]types.Node{italic("Figure 1"), img}, ""},
+		{[]types.Node{img, img, italic("Figure 1")}, ""},
+	}
+	for i, tc := range tests {
+		n, caption := ImageCaption(tc.in)
+		if caption != tc.caption {
+			t.Errorf("%d: caption = %q; want %q", i, caption, tc.caption)
+		}
+		if (n != nil) != (tc.caption != "") {
+			t.Errorf("%d: image = %v; want image only with a caption", i, n)
+		}
+	}
+}
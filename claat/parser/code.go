@@ -0,0 +1,130 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/CloudVLab/tools/claat/types"
+)
+
+// codeLangs maps source file extensions to code languages.
+var codeLangs = map[string]string{
+	".c":     "c",
+	".cc":    "cpp",
+	".cpp":   "cpp",
+	".cs":    "csharp",
+	".css":   "css",
+	".dart":  "dart",
+	".go":    "go",
+	".h":     "c",
+	".html":  "html",
+	".java":  "java",
+	".js":    "javascript",
+	".json":  "json",
+	".kt":    "kotlin",
+	".php":   "php",
+	".py":    "python",
+	".rb":    "ruby",
+	".rs":    "rust",
+	".sh":    "bash",
+	".sql":   "sql",
+	".swift": "swift",
+	".tf":    "hcl",
+	".ts":    "typescript",
+	".xml":   "xml",
+	".yaml":  "yaml",
+	".yml":   "yaml",
+}
+
+// CodeLang returns the code language of a source file named name,
+// inferred from its extension. It returns an empty string if the extension is unknown.
+func CodeLang(name string) string {
+	if i := strings.IndexAny(name, "?#"); i >= 0 {
+		name = name[:i]
+	}
+	return codeLangs[strings.ToLower(path.Ext(name))]
+}
+
+// codeDirective is the [[code URL selector]] directive, which results in a types.CodeNode
+// whose content is included from the source file at URL when the codelab is fetched.
+// The URL must be a link. The optional selector is either a line range, such as 10-20,
+// 10- or 10, or the name of a region marked with "[START name]" and "[END name]" comments.
+// Source files are fetched along with imports: if the parser has not been asked
+// to parse imports, the directive is kept as is.
+func codeDirective(d *Directive) (types.Node, error) {
+	if !d.ParseImports {
+		return nil, nil
+	}
+	if len(d.Args) == 0 {
+		return nil, errors.New("needs a link to the source file")
+	}
+	u, ok := d.Args[0].(*types.URLNode)
+	if !ok {
+		return nil, errors.New("first argument must be a link to the source file")
+	}
+	var sel []string
+	for _, a := range d.Args[1:] {
+		t, ok := a.(*types.TextNode)
+		if !ok {
+			return nil, fmt.Errorf("unexpected %T argument", a)
+		}
+		sel = append(sel, strings.Fields(t.Value)...)
+	}
+	if len(sel) > 1 {
+		return nil, fmt.Errorf("too many arguments: %q", strings.Join(sel, " "))
+	}
+
+	inc := &types.CodeInclude{URL: u.URL}
+	if len(sel) == 1 {
+		if err := parseCodeSelector(inc, sel[0]); err != nil {
+			return nil, err
+		}
+	}
+	n := types.NewCodeNode("", false)
+	n.Lang = CodeLang(u.URL)
+	n.Include = inc
+	n.MutateBlock(true)
+	return n, nil
+}
+
+// parseCodeSelector sets either the line range or the region of inc from s.
+// A selector starting with a digit is a line range. Its bounds may also be
+// separated by an en dash, which word processors often substitute for a hyphen.
+func parseCodeSelector(inc *types.CodeInclude, s string) error {
+	if s[0] < '0' || s[0] > '9' {
+		inc.Region = s
+		return nil
+	}
+	parts := strings.SplitN(strings.Replace(s, "\u2013", "-", 1), "-", 2)
+	start, err := strconv.Atoi(parts[0])
+	if err != nil || start < 1 {
+		return fmt.Errorf("invalid line range %q", s)
+	}
+	inc.Start, inc.End = start, start
+	if len(parts) == 2 {
+		inc.End = 0
+		if parts[1] != "" {
+			if inc.End, err = strconv.Atoi(parts[1]); err != nil || inc.End < start {
+				return fmt.Errorf("invalid line range %q", s)
+			}
+		}
+	}
+	return nil
+}
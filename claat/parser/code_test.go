@@ -0,0 +1,86 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parser
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/CloudVLab/tools/claat/types"
+)
+
+func TestCodeLang(t *testing.T) {
+	tests := []struct{ in, out string }{
+		{"main.go", "go"},
+		{"samples/App.JAVA", "java"},
+		{"https://example.com/app.py?raw=true", "python"},
+		{"Makefile", ""},
+	}
+	for _, tc := range tests {
+		if out := CodeLang(tc.in); out != tc.out {
+			t.Errorf("CodeLang(%q) = %q; want %q", tc.in, out, tc.out)
+		}
+	}
+}
+
+func TestCodeDirective(t *testing.T) {
+	link := types.NewURLNode("samples/main.go", types.NewTextNode("main.go"))
+	tests := []struct {
+		sel string
+		inc *types.CodeInclude
+	}{
+		{"", &types.CodeInclude{URL: "samples/main.go"}},
+		{" 10-20", &types.CodeInclude{URL: "samples/main.go", Start: 10, End: 20}},
+		{"10\u201320", &types.CodeInclude{URL: "samples/main.go", Start: 10, End: 20}},
+		{"10-", &types.CodeInclude{URL: "samples/main.go", Start: 10}},
+		{"7", &types.CodeInclude{URL: "samples/main.go", Start: 7, End: 7}},
+		{"setup", &types.CodeInclude{URL: "samples/main.go", Region: "setup"}},
+	}
+	for _, tc := range tests {
+		d := &Directive{Name: "code", Args: []types.Node{link}, ParseImports: true}
+		if tc.sel != "" {
+			d.Args = append(d.Args, types.NewTextNode(tc.sel))
+		}
+		n, err := codeDirective(d)
+		if err != nil {
+			t.Errorf("%q: %v", tc.sel, err)
+			continue
+		}
+		cn, ok := n.(*types.CodeNode)
+		if !ok {
+			t.Errorf("%q: codeDirective = %T; want *types.CodeNode", tc.sel, n)
+			continue
+		}
+		if cn.Lang != "go" || cn.Block() != true || cn.Empty() {
+			t.Errorf("%q: Lang = %q, block = %v, empty = %v; want go, true, false", tc.sel, cn.Lang, cn.Block(), cn.Empty())
+		}
+		if !reflect.DeepEqual(cn.Include, tc.inc) {
+			t.Errorf("%q: Include = %+v; want %+v", tc.sel, cn.Include, tc.inc)
+		}
+	}
+
+	for _, sel := range []string{"20-10", "0-5", "1-x", "one two"} {
+		d := &Directive{Name: "code", Args: []types.Node{link, types.NewTextNode(sel)}, ParseImports: true}
+		if _, err := codeDirective(d); err == nil {
+			t.Errorf("%q: no error", sel)
+		}
+	}
+	if _, err := codeDirective(&Directive{Name: "code", Args: []types.Node{types.NewTextNode("main.go")}, ParseImports: true}); err == nil {
+		t.Error("codeDirective without a link: no error")
+	}
+	if n, err := codeDirective(&Directive{Name: "code", Args: []types.Node{link}}); n != nil || err != nil {
+		t.Errorf("codeDirective without ParseImports = %v, %v; want nil, nil", n, err)
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/CloudVLab/tools/claat/types"
+)
+
+const (
+	directiveOpen  = "[[" // start of a directive paragraph
+	directiveClose = "]]" // end of a directive paragraph
+)
+
+// Directive is a [[name args...]] instruction found in a codelab source,
+// written as a paragraph starting with "[[" followed by the directive name
+// in bold, its arguments and a closing "]]", e.g.
+//
+//	[[**import** [shared](https://example.com/shared.md)]]
+type Directive struct {
+	Name         string       // lower case directive name
+	Args         []types.Node // argument nodes, without separating white space
+	ParseImports bool         // whether the parser has been asked to parse imports
+}
+
+// DirectiveFunc executes directive d. It returns the node which replaces
+// the directive paragraph, or nil if the paragraph is to be kept as is.
+// An error means the directive is malformed; it is reported as a parser warning.
+type DirectiveFunc func(d *Directive) (types.Node, error)
+
+var (
+	directivesMu sync.Mutex // guards directives
+	directives   = make(map[string]DirectiveFunc)
+)
+
+// init registers the directives built into CLaaT.
+func init() {
+	RegisterDirective("import", importDirective)
+	RegisterDirective("code", codeDirective)
+}
+
+// RegisterDirective registers a new directive fn under specified name.
+// Directive names are case-insensitive.
+// It panics if another directive is already registered under the same name.
+func RegisterDirective(name string, fn DirectiveFunc) {
+	name = strings.ToLower(name)
+	directivesMu.Lock()
+	defer directivesMu.Unlock()
+	if _, exists := directives[name]; exists {
+		panic(fmt.Sprintf("directive %q already registered", name))
+	}
+	directives[name] = fn
+}
+
+// Directives returns a sorted slice of all registered directive names.
+func Directives() []string {
+	directivesMu.Lock()
+	defer directivesMu.Unlock()
+	d := make([]string, 0, len(directives))
+	for k := range directives {
+		d = append(d, k)
+	}
+	sort.Strings(d)
+	return d
+}
+
+// LookupDirective returns the directive registered under name, if any.
+func LookupDirective(name string) (DirectiveFunc, bool) {
+	directivesMu.Lock()
+	defer directivesMu.Unlock()
+	fn, ok := directives[strings.ToLower(name)]
+	return fn, ok
+}
+
+// ParseDirective checks whether nodes, the content of a paragraph, form a directive.
+// It returns the directive, or nil if nodes are not a directive. The directive
+// name is returned in d.Name even if no such directive is registered.
+// The returned directive has d.ParseImports unset.
+func ParseDirective(nodes []types.Node) *Directive {
+	// [[ directive ... ]]
+	if len(nodes) < 3 {
+		return nil
+	}
+	// first element is opening [[
+	if t, ok := nodes[0].(*types.TextNode); !ok || strings.TrimSpace(t.Value) != directiveOpen {
+		return nil
+	}
+	// last element ends with closing ]], possibly preceded by a text argument
+	last, ok := nodes[len(nodes)-1].(*types.TextNode)
+	if !ok || !strings.HasSuffix(strings.TrimSpace(last.Value), directiveClose) {
+		return nil
+	}
+	// second element is a text in bold
+	t, ok := nodes[1].(*types.TextNode)
+	if !ok || !t.Bold || t.Italic || t.Code {
+		return nil
+	}
+	d := &Directive{Name: strings.ToLower(strings.TrimSpace(t.Value))}
+	// arguments are everything in between, except for the separating spaces
+	args := nodes[2 : len(nodes)-1]
+	if v := strings.TrimSuffix(strings.TrimSpace(last.Value), directiveClose); v != "" {
+		arg := *last
+		arg.Value = v
+		args = append(args[:len(args):len(args)], &arg)
+	}
+	for _, n := range args {
+		if !n.Empty() {
+			d.Args = append(d.Args, n)
+		}
+	}
+	return d
+}
+
+// importDirective is the [[import URL]] directive, which results in a types.ImportNode.
+// The URL must be the only argument, and be a link.
+func importDirective(d *Directive) (types.Node, error) {
+	if !d.ParseImports {
+		return nil, nil
+	}
+	if len(d.Args) == 1 {
+		if u, ok := d.Args[0].(*types.URLNode); ok {
+			return types.NewImportNode(u.URL), nil
+		}
+	}
+	return nil, errors.New("needs a single link argument")
+}
@@ -0,0 +1,100 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parser
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/CloudVLab/tools/claat/types"
+)
+
+func TestParseDirective(t *testing.T) {
+	bold := func(s string) types.Node {
+		n := types.NewTextNode(s)
+		n.Bold = true
+		return n
+	}
+	link := types.NewURLNode("https://example.com/shared.md", types.NewTextNode("shared"))
+	tests := []struct {
+		in  []types.Node
+		out *Directive
+	}{
+		{
+			[]types.Node{types.NewTextNode("[["), bold("Import"), types.NewTextNode(" "), link, types.NewTextNode("]]")},
+			&Directive{Name: "import", Args: []types.Node{link}},
+		},
+		{
+			[]types.Node{types.NewTextNode("[["), bold("toc "), types.NewTextNode("]]")},
+			&Directive{Name: "toc"},
+		},
+		// name is not bold
+		{[]types.Node{types.NewTextNode("[["), types.NewTextNode("import"), link, types.NewTextNode("]]")}, nil},
+		// not closed
+		{[]types.Node{types.NewTextNode("[["), bold("import"), link}, nil},
+		{[]types.Node{types.NewTextNode("text")}, nil},
+	}
+	for i, tc := range tests {
+		out := ParseDirective(tc.in)
+		if !reflect.DeepEqual(out, tc.out) {
+			t.Errorf("%d: ParseDirective = %+v; want %+v", i, out, tc.out)
+		}
+	}
+}
+
+func TestRegisterDirective(t *testing.T) {
+	fn := func(d *Directive) (types.Node, error) {
+		return types.NewTextNode(d.Name), nil
+	}
+	RegisterDirective("Test-Echo", fn)
+	got, ok := LookupDirective("test-echo")
+	if !ok {
+		t.Fatal("LookupDirective(test-echo): not found")
+	}
+	n, err := got(&Directive{Name: "test-echo"})
+	if err != nil || !reflect.DeepEqual(n, types.NewTextNode("test-echo")) {
+		t.Errorf("test-echo directive = %v, %v; want text node", n, err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("RegisterDirective did not panic on a duplicate name")
+		}
+	}()
+	RegisterDirective("test-echo", fn)
+}
+
+func TestImportDirective(t *testing.T) {
+	link := types.NewURLNode("https://example.com/shared.md")
+	tests := []struct {
+		d   *Directive
+		out types.Node
+		err bool
+	}{
+		{&Directive{Name: "import", Args: []types.Node{link}, ParseImports: true}, types.NewImportNode("https://example.com/shared.md"), false},
+		{&Directive{Name: "import", Args: []types.Node{link}}, nil, false},
+		{&Directive{Name: "import", Args: []types.Node{types.NewTextNode("shared.md")}, ParseImports: true}, nil, true},
+		{&Directive{Name: "import", ParseImports: true}, nil, true},
+	}
+	for i, tc := range tests {
+		out, err := importDirective(tc.d)
+		if (err != nil) != tc.err {
+			t.Errorf("%d: importDirective err = %v; want error: %v", i, err, tc.err)
+		}
+		if !reflect.DeepEqual(out, tc.out) {
+			t.Errorf("%d: importDirective = %+v; want %+v", i, out, tc.out)
+		}
+	}
+}
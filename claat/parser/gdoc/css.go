@@ -20,20 +20,14 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/CloudVLab/tools/claat/types"
 	"github.com/x1ddos/csslex"
 	"golang.org/x/net/html"
 	"golang.org/x/net/html/atom"
 )
 
-const (
-	metaColor       = "#b7b7b7"     // step meta instruction
-	buttonColor     = "#6aa84f"     // button background color
-	fontCode        = "courier new" // source code format in original doc
-	fontConsole     = "consolas"    // terminal text format in original doc
-	ibPositiveColor = "#d9ead3"     // positive infobox background
-	ibNegativeColor = "#fce5cd"     // negative infobox background
-	surveyColor     = "#cfe2f3"     // survey background color
-)
+// listIndent is the left margin of each list level, in points.
+const listIndent = 36
 
 // cssStyle represents styles of an exported Google Doc.
 type cssStyle map[string]map[string]string
@@ -109,6 +103,77 @@ func hasClass(hn *html.Node, name string) bool {
 	return i < len(cls) && cls[i] == name
 }
 
+// listClass returns the class of list element hn identifying the list it is a part of
+// and its nesting level, such as "lst-kix_abc123-0", or an empty string if hn has none.
+func listClass(hn *html.Node) string {
+	for _, c := range classList(hn) {
+		if strings.HasPrefix(c, "lst-") {
+			return c
+		}
+	}
+	return ""
+}
+
+// listLevel returns the nesting level of list element hn, starting at 0 for top level lists.
+// The level is either the suffix of the list class, or inferred from the left margin of its items.
+func listLevel(css cssStyle, hn *html.Node) int {
+	if c := listClass(hn); c != "" {
+		if i := strings.LastIndex(c, "-"); i > 0 {
+			if n, err := strconv.Atoi(c[i+1:]); err == nil {
+				return n
+			}
+		}
+	}
+	li := findAtom(hn, atom.Li)
+	if li == nil {
+		return 0
+	}
+	v := classStyleValue(css, li, "margin-left")
+	if v == "" {
+		v = classStyleValue(css, hn, "margin-left")
+	}
+	m, err := strconv.ParseFloat(strings.TrimSuffix(v, "pt"), 32)
+	if err != nil || m < listIndent {
+		return 0
+	}
+	return int(m/listIndent+0.5) - 1
+}
+
+// imageAlign returns the alignment of image hn, set by the float of either the image
+// or its wrapping <span>. Images standing alone also follow the text alignment of
+// their paragraph, block parent bp.
+func imageAlign(css cssStyle, hn, bp *html.Node, inline bool) types.ImageAlign {
+	for p := hn; p != nil && (p == hn || p.DataAtom == atom.Span); p = p.Parent {
+		switch styleValue(p, "float") {
+		case "left":
+			return types.ImageAlignLeft
+		case "right":
+			return types.ImageAlignRight
+		}
+	}
+	if bp == nil || inline {
+		return ""
+	}
+	switch classStyleValue(css, bp, "text-align") {
+	case "center":
+		return types.ImageAlignCenter
+	case "right":
+		return types.ImageAlignRight
+	}
+	return ""
+}
+
+// classStyleValue returns the value of style property key of node hn,
+// from either its class styles or its inline style.
+func classStyleValue(css cssStyle, hn *html.Node, key string) string {
+	for _, c := range classList(hn) {
+		if v, ok := css["."+c][key]; ok {
+			return v
+		}
+	}
+	return styleValue(hn, key)
+}
+
 // hasClassStyle returns true if the node hn has a CSS class style property key
 // with the value val.
 func hasClassStyle(css cssStyle, hn *html.Node, key, val string) bool {
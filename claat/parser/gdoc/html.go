@@ -16,10 +16,13 @@ package gdoc
 
 import (
 	"bytes"
+	"fmt"
 	"strings"
 
 	"golang.org/x/net/html"
 	"golang.org/x/net/html/atom"
+
+	"github.com/CloudVLab/tools/claat/types"
 )
 
 var (
@@ -40,8 +43,8 @@ func isHeader(hn *html.Node) bool {
 	return ok
 }
 
-func isMeta(css cssStyle, hn *html.Node) bool {
-	return hasClassStyle(css, hn, "color", metaColor)
+func isMeta(css cssStyle, sp *StyleProfile, hn *html.Node) bool {
+	return hasClassStyle(css, hn, "color", sp.MetaColor)
 }
 
 func isBold(css cssStyle, hn *html.Node) bool {
@@ -63,44 +66,92 @@ func isItalic(css cssStyle, hn *html.Node) bool {
 		hasClassStyle(css, hn, "font-style", "italic")
 }
 
-func isConsole(css cssStyle, hn *html.Node) bool {
+func isStrikethrough(css cssStyle, hn *html.Node) bool {
+	if hn.Type == html.TextNode {
+		hn = hn.Parent
+	}
+	return hn.DataAtom == atom.S ||
+		hn.DataAtom == atom.Strike ||
+		hn.DataAtom == atom.Del ||
+		strings.Contains(classStyleValue(css, hn, "text-decoration"), "line-through")
+}
+
+func isUnderline(css cssStyle, hn *html.Node) bool {
 	if hn.Type == html.TextNode {
 		hn = hn.Parent
 	}
-	return hasClassStyle(css, hn, "font-family", fontConsole)
+	return hn.DataAtom == atom.U ||
+		strings.Contains(classStyleValue(css, hn, "text-decoration"), "underline")
 }
 
-func isCode(css cssStyle, hn *html.Node) bool {
+func isSuperscript(css cssStyle, hn *html.Node) bool {
 	if hn.Type == html.TextNode {
 		hn = hn.Parent
 	}
-	return hasClassStyle(css, hn, "font-family", fontCode)
+	return hn.DataAtom == atom.Sup ||
+		hasClassStyle(css, hn, "vertical-align", "super")
 }
 
-func isButton(css cssStyle, hn *html.Node) bool {
-	return hasClassStyle(css, hn, "background-color", buttonColor)
+func isSubscript(css cssStyle, hn *html.Node) bool {
+	if hn.Type == html.TextNode {
+		hn = hn.Parent
+	}
+	return hn.DataAtom == atom.Sub ||
+		hasClassStyle(css, hn, "vertical-align", "sub")
 }
 
-func isInfobox(css cssStyle, hn *html.Node) bool {
+// textRole returns the semantic role of text hn, which is marked with a background color.
+func textRole(css cssStyle, sp *StyleProfile, hn *html.Node) types.TextRole {
+	if hn.Type == html.TextNode {
+		hn = hn.Parent
+	}
+	switch {
+	case hasClassStyle(css, hn, "background-color", sp.PlaceholderColor):
+		return types.TextPlaceholder
+	case hasClassStyle(css, hn, "background-color", sp.UIColor):
+		return types.TextUI
+	}
+	return ""
+}
+
+func isConsole(css cssStyle, sp *StyleProfile, hn *html.Node) bool {
+	if hn.Type == html.TextNode {
+		hn = hn.Parent
+	}
+	return hasClassStyle(css, hn, "font-family", sp.ConsoleFont)
+}
+
+func isCode(css cssStyle, sp *StyleProfile, hn *html.Node) bool {
+	if hn.Type == html.TextNode {
+		hn = hn.Parent
+	}
+	return hasClassStyle(css, hn, "font-family", sp.CodeFont)
+}
+
+func isButton(css cssStyle, sp *StyleProfile, hn *html.Node) bool {
+	return hasClassStyle(css, hn, "background-color", sp.ButtonColor)
+}
+
+func isInfobox(css cssStyle, sp *StyleProfile, hn *html.Node) bool {
 	if hn.DataAtom != atom.Td {
 		return false
 	}
-	return hasClassStyle(css, hn, "background-color", ibPositiveColor) ||
-		isInfoboxNegative(css, hn)
+	return hasClassStyle(css, hn, "background-color", sp.PositiveColor) ||
+		isInfoboxNegative(css, sp, hn)
 }
 
-func isInfoboxNegative(css cssStyle, hn *html.Node) bool {
+func isInfoboxNegative(css cssStyle, sp *StyleProfile, hn *html.Node) bool {
 	if hn.DataAtom != atom.Td {
 		return false
 	}
-	return hasClassStyle(css, hn, "background-color", ibNegativeColor)
+	return hasClassStyle(css, hn, "background-color", sp.NegativeColor)
 }
 
-func isSurvey(css cssStyle, hn *html.Node) bool {
+func isSurvey(css cssStyle, sp *StyleProfile, hn *html.Node) bool {
 	if hn.DataAtom != atom.Td {
 		return false
 	}
-	return hasClassStyle(css, hn, "background-color", surveyColor)
+	return hasClassStyle(css, hn, "background-color", sp.SurveyColor)
 }
 
 func isComment(css cssStyle, hn *html.Node) bool {
@@ -213,6 +264,34 @@ func findBlockParent(hn *html.Node) *html.Node {
 	return nil
 }
 
+// nodePath returns the element path of hn, starting at <body>,
+// e.g. "body/p[3]/span[1]". Each element is numbered among its siblings
+// of the same name, starting with 1. Text nodes are named "text()".
+func nodePath(hn *html.Node) string {
+	var parts []string
+	for ; hn != nil && hn.DataAtom != atom.Html; hn = hn.Parent {
+		if hn.DataAtom == atom.Body {
+			parts = append(parts, "body")
+			break
+		}
+		name := hn.Data
+		if hn.Type == html.TextNode {
+			name = "text()"
+		}
+		i := 1
+		for s := hn.PrevSibling; s != nil; s = s.PrevSibling {
+			if s.Type == hn.Type && (hn.Type == html.TextNode || s.Data == hn.Data) {
+				i++
+			}
+		}
+		parts = append(parts, fmt.Sprintf("%s[%d]", name, i))
+	}
+	for i, j := 0, len(parts)-1; i < j; i, j = i+1, j-1 {
+		parts[i], parts[j] = parts[j], parts[i]
+	}
+	return strings.Join(parts, "/")
+}
+
 // nodeAttr returns node attribute value of the key name.
 // Attribute keys are case insensitive.
 func nodeAttr(n *html.Node, name string) string {
@@ -37,6 +37,17 @@ func init() {
 
 // Parser is a Google Doc parser.
 type Parser struct {
+	// Profile is the style conventions of the parsed docs.
+	// The default profile is used if Profile is nil.
+	Profile *StyleProfile
+}
+
+// profile returns the style profile of p.
+func (p *Parser) profile() *StyleProfile {
+	if p.Profile == nil {
+		return DefaultProfile()
+	}
+	return p.Profile
 }
 
 // Parse parses a codelab exported in HTML from Google Docs.
@@ -46,26 +57,24 @@ func (p *Parser) Parse(r io.Reader, parseImports bool) (*types.Codelab, error) {
 	if err != nil {
 		return nil, err
 	}
-	return parseDoc(doc, parseImports)
+	return parseDoc(doc, p.profile(), parseImports)
 }
 
 // ParseFragment parses a codelab fragment exported in HTML from Google Docs.
-func (p *Parser) ParseFragment(r io.Reader, parseImports bool) ([]types.Node, error) {
+func (p *Parser) ParseFragment(r io.Reader, parseImports bool) ([]types.Node, []*types.Warning, error) {
 	// TODO: use html.Tokenizer instead
 	doc, err := html.Parse(r)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	return parseFragment(doc)
+	return parseFragment(doc, p.profile())
 }
 
 const (
 	metaSep         = ":"           // step instruction format, key:value
 	metaDuration    = "duration"    // step duration instruction
 	metaEnvironment = "environment" // step environment instruction
-	metaTagOpen     = "[["          // start of tag-based meta instruction
-	metaTagClose    = "]]"          // end of tag-based meta instruction
-	metaTagImport   = "import"      // import remote resource instruction
+	metaLanguage    = "language"    // code language of the next code block
 
 	// possible content of special header nodes in lower case.
 	headerLearn = "what you'll learn"
@@ -109,16 +118,35 @@ const (
 )
 
 type docState struct {
-	clab     *types.Codelab // codelab and its metadata
-	totdur   time.Duration  // total codelab duration
-	survey   int            // last used survey ID
-	css      cssStyle       // styles of the doc
-	step     *types.Step    // current codelab step
-	lastNode types.Node     // last appended node
-	env      []string       // current enviornment
-	cur      *html.Node     // current HTML node
-	flags    stateFlag      // current flags
-	stack    []*stackItem   // cur and flags stack
+	clab      *types.Codelab // codelab and its metadata
+	totdur    time.Duration  // total codelab duration
+	survey    int            // last used survey ID
+	css       cssStyle       // styles of the doc
+	profile   *StyleProfile  // style conventions of the doc
+	step      *types.Step    // current codelab step
+	lastNode  types.Node     // last appended node
+	env       []string       // current enviornment
+	codeLang  string         // language hint of the next code block
+	codeCell  *html.Node     // table cell of the code block codeLang applies to
+	cur       *html.Node     // current HTML node
+	flags     stateFlag      // current flags
+	stack     []*stackItem   // cur and flags stack
+	warnings  []*types.Warning
+	derivedID bool // clab.ID is derived from the title
+
+	// listItems is the number of items of each numbered list parsed so far,
+	// keyed by list class. Docs exports a list interrupted by other content,
+	// such as a code block, as several <ol> elements with the same class.
+	listItems map[string]int
+	// lists is the chain of lists the next nested list may belong to,
+	// starting with the last top level list of the step, by increasing level.
+	lists []*nestedList
+}
+
+// nestedList is a list at a given nesting level.
+type nestedList struct {
+	node  *types.ItemsListNode
+	level int
 }
 
 type stackItem struct {
@@ -135,6 +163,15 @@ func (ds *docState) push(cur *html.Node, flags stateFlag) {
 	ds.flags = flags
 }
 
+// warn records a non-fatal problem found at pos.
+func (ds *docState) warn(sev types.Severity, pos types.Pos, format string, args ...interface{}) {
+	ds.warnings = append(ds.warnings, &types.Warning{
+		Severity: sev,
+		Pos:      pos,
+		Msg:      fmt.Sprintf(format, args...),
+	})
+}
+
 func (ds *docState) pop() {
 	n := len(ds.stack)
 	if n == 0 {
@@ -159,18 +196,19 @@ func (ds *docState) appendNodes(nn ...types.Node) {
 	ds.lastNode = nn[len(nn)-1]
 }
 
-func parseFragment(doc *html.Node) ([]types.Node, error) {
+func parseFragment(doc *html.Node, profile *StyleProfile) ([]types.Node, []*types.Warning, error) {
 	body := findAtom(doc, atom.Body)
 	if body == nil {
-		return nil, fmt.Errorf("document without a body")
+		return nil, nil, fmt.Errorf("document without a body")
 	}
 	style, err := parseStyle(doc)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	ds := &docState{
-		clab: &types.Codelab{},
-		css:  style,
+		clab:    &types.Codelab{},
+		css:     style,
+		profile: profile,
 	}
 	ds.step = ds.clab.NewStep("fragment")
 	for ds.cur = body.FirstChild; ds.cur != nil; ds.cur = ds.cur.NextSibling {
@@ -180,13 +218,13 @@ func parseFragment(doc *html.Node) ([]types.Node, error) {
 		}
 		parseTop(ds)
 	}
-	finalizeStep(ds.step, ds.flags&fSkipImport == 0)
-	return ds.step.Content.Nodes, nil
+	finalizeStep(ds)
+	return ds.step.Content.Nodes, ds.warnings, nil
 }
 
 // parseDoc parses codelab doc exported as text/html.
 // The doc must contain CSS styles and <body> as exported from Google Doc.
-func parseDoc(doc *html.Node, parseImports bool) (*types.Codelab, error) {
+func parseDoc(doc *html.Node, profile *StyleProfile, parseImports bool) (*types.Codelab, error) {
 	body := findAtom(doc, atom.Body)
 	if body == nil {
 		return nil, fmt.Errorf("document without a body")
@@ -202,9 +240,10 @@ func parseDoc(doc *html.Node, parseImports bool) (*types.Codelab, error) {
 	}
 
 	ds := &docState{
-		clab:  &types.Codelab{},
-		css:   style,
-		flags: flags,
+		clab:    &types.Codelab{},
+		css:     style,
+		profile: profile,
+		flags:   flags,
 	}
 	for ds.cur = body.FirstChild; ds.cur != nil; ds.cur = ds.cur.NextSibling {
 		if isComment(ds.css, ds.cur) {
@@ -218,6 +257,7 @@ func parseDoc(doc *html.Node, parseImports bool) (*types.Codelab, error) {
 			}
 			if ds.clab.ID == "" {
 				ds.clab.ID = slug(ds.clab.Title)
+				ds.derivedID = true
 			}
 			continue
 		case ds.cur.DataAtom == atom.Table && ds.step == nil:
@@ -233,14 +273,21 @@ func parseDoc(doc *html.Node, parseImports bool) (*types.Codelab, error) {
 		}
 	}
 
-	finalizeStep(ds.step, ds.flags&fSkipImport == 0) // TODO: last ds.step is never finalized in newStep
+	finalizeStep(ds) // TODO: last ds.step is never finalized in newStep
 	ds.clab.Tags = unique(ds.clab.Tags)
 	sort.Strings(ds.clab.Tags)
 	ds.clab.Duration = int(ds.totdur.Minutes())
+	if ds.derivedID {
+		ds.warn(types.SeverityInfo, types.Pos{}, "%s", parser.MsgDerivedID)
+	}
+	ds.clab.Warnings = ds.warnings
 	return ds.clab, nil
 }
 
-func finalizeStep(s *types.Step, shouldParseImports bool) {
+// finalizeStep cleans up the nodes of the current step ds.step and executes
+// its [[directive]] instructions. Unknown directives are reported as warnings.
+func finalizeStep(ds *docState) {
+	s := ds.step
 	if s == nil {
 		return
 	}
@@ -248,6 +295,8 @@ func finalizeStep(s *types.Step, shouldParseImports bool) {
 	sort.Strings(s.Tags)
 	s.Content.Nodes = blockNodes(s.Content.Nodes)
 	s.Content.Nodes = compactNodes(s.Content.Nodes)
+	s.Content.Nodes = captionImages(s.Content.Nodes)
+	guessCodeLangs(s.Content.Nodes)
 	// TODO: find a better place for the code below
 	// find [[directive]] instructions and act accordingly
 	for i, n := range s.Content.Nodes {
@@ -255,42 +304,78 @@ func finalizeStep(s *types.Step, shouldParseImports bool) {
 			continue
 		}
 		l := n.(*types.ListNode)
-		// [[ directive ... ]]
-		if len(l.Nodes) < 4 {
-			continue
-		}
-		// first element is opening [[
-		if t, ok := l.Nodes[0].(*types.TextNode); !ok || t.Value != metaTagOpen {
-			continue
-		}
-		// last element is closing ]]
-		if t, ok := l.Nodes[len(l.Nodes)-1].(*types.TextNode); !ok || t.Value != metaTagClose {
-			continue
-		}
-		// second element is a text in bold
-		t, ok := l.Nodes[1].(*types.TextNode)
-		if !ok || !t.Bold || t.Italic || t.Code {
+		d := parser.ParseDirective(l.Nodes)
+		if d == nil {
 			continue
 		}
-		// execute transform and replace t with the result
-		v := strings.ToLower(strings.TrimSpace(t.Value))
-		r := transformNodes(v, l.Nodes[2:len(l.Nodes)-1], shouldParseImports)
+		// execute transform and replace l with the result
+		r := transformNodes(ds, l, d)
 		if r != nil {
 			r.MutateEnv(l.Env())
+			r.MutatePos(l.Pos())
 			s.Content.Nodes[i] = r
 		}
 	}
 }
 
-func transformNodes(name string, nodes []types.Node, shouldParseImports bool) types.Node {
-	if name == metaTagImport && len(nodes) == 1 && shouldParseImports {
-		u, ok := nodes[0].(*types.URLNode)
-		if !ok {
-			return nil
+// guessCodeLangs sets the language of code blocks written without
+// a language hint, as guessed from their content by parser.GuessCodeLang.
+// Terminal commands are left as is.
+func guessCodeLangs(nodes []types.Node) {
+	types.Walk(nodes, func(n types.Node) {
+		if c, ok := n.(*types.CodeNode); ok && !c.Term && c.Lang == "" {
+			c.Lang = parser.GuessCodeLang(c.Value)
+		}
+	})
+}
+
+// captionImages finds paragraphs made of a single image, followed by a paragraph
+// in italics, and makes the latter the image caption.
+// It also handles the caption following the image in the same paragraph.
+func captionImages(nodes []types.Node) []types.Node {
+	res := make([]types.Node, 0, len(nodes))
+	for i := 0; i < len(nodes); i++ {
+		l, ok := nodes[i].(*types.ListNode)
+		if !ok || len(l.Nodes) == 0 {
+			res = append(res, nodes[i])
+			continue
 		}
-		return types.NewImportNode(u.URL)
+		if img, caption := parser.ImageCaption(l.Nodes); img != nil {
+			// the caption text made the image look inline
+			img.Caption = caption
+			img.Inline = false
+			l.Nodes = l.Nodes[:1]
+		} else if len(l.Nodes) == 1 && i+1 < len(nodes) {
+			next, ok := nodes[i+1].(*types.ListNode)
+			if !ok {
+				res = append(res, l)
+				continue
+			}
+			if img, caption := parser.ImageCaption(append(l.Nodes[:1:1], next.Nodes...)); img != nil {
+				img.Caption = caption
+				i++
+			}
+		}
+		res = append(res, l)
 	}
-	return nil
+	return res
+}
+
+// transformNodes executes directive d of paragraph l, using the directive registered under d.Name.
+// It returns the resulting node, or nil if l is to be left as is.
+func transformNodes(ds *docState, l *types.ListNode, d *parser.Directive) types.Node {
+	fn, ok := parser.LookupDirective(d.Name)
+	if !ok {
+		ds.warn(types.SeverityWarning, l.Pos(), "unknown directive [[%s]]", d.Name)
+		return nil
+	}
+	d.ParseImports = ds.flags&fSkipImport == 0
+	r, err := fn(d)
+	if err != nil {
+		ds.warn(types.SeverityError, l.Pos(), "[[%s]]: %v", d.Name, err)
+		return nil
+	}
+	return r
 }
 
 // parseTop parses nodes tree starting at, and including, ds.cur.
@@ -333,9 +418,20 @@ func parseSubtree(ds *docState) []types.Node {
 // but resuling types.Node is nil.
 //
 // The flag argument modifies default behavour of the func.
+// The position of the returned node is set to the element path of hn.
 func parseNode(ds *docState) (types.Node, bool) {
+	hn := ds.cur
+	n, ok := parseNodeContent(ds)
+	if n != nil {
+		n.MutatePos(types.Pos{Path: nodePath(hn)})
+	}
+	return n, ok
+}
+
+// parseNodeContent does the actual work of parseNode.
+func parseNodeContent(ds *docState) (types.Node, bool) {
 	switch {
-	case isMeta(ds.css, ds.cur):
+	case isMeta(ds.css, ds.profile, ds.cur):
 		metaStep(ds)
 		return nil, true
 	case ds.cur.Type == html.TextNode || ds.cur.DataAtom == atom.Br:
@@ -344,19 +440,19 @@ func parseNode(ds *docState) (types.Node, bool) {
 		return link(ds), true
 	case ds.cur.DataAtom == atom.Img:
 		return image(ds), true
-	case isButton(ds.css, ds.cur):
+	case isButton(ds.css, ds.profile, ds.cur):
 		return button(ds), true
 	case ds.flags&fSkipHeader == 0 && isHeader(ds.cur):
 		return header(ds), true
 	case ds.flags&fSkipList == 0 && isList(ds.cur):
 		return list(ds), true
-	case ds.flags&fSkipCode == 0 && isConsole(ds.css, ds.cur):
+	case ds.flags&fSkipCode == 0 && isConsole(ds.css, ds.profile, ds.cur):
 		return code(ds, true), true
-	case ds.flags&fSkipCode == 0 && isCode(ds.css, ds.cur):
+	case ds.flags&fSkipCode == 0 && isCode(ds.css, ds.profile, ds.cur):
 		return code(ds, false), true
-	case ds.flags&fSkipInfobox == 0 && isInfobox(ds.css, ds.cur):
+	case ds.flags&fSkipInfobox == 0 && isInfobox(ds.css, ds.profile, ds.cur):
 		return infobox(ds), true
-	case ds.flags&fSkipSurvey == 0 && isSurvey(ds.css, ds.cur):
+	case ds.flags&fSkipSurvey == 0 && isSurvey(ds.css, ds.profile, ds.cur):
 		return survey(ds), true
 	case ds.flags&fSkipTable == 0 && isTable(ds.cur):
 		return table(ds), true
@@ -364,6 +460,66 @@ func parseNode(ds *docState) (types.Node, bool) {
 	return nil, false
 }
 
+// nestList nests list l of the specified level in the last item of the list
+// it belongs to, if l directly follows that list. Items of a list with the same
+// level as the previous nested list are appended to the latter.
+// It reports whether l has been nested.
+func (ds *docState) nestList(l *types.ItemsListNode, level int) bool {
+	if len(ds.lists) == 0 || ds.lastNode != types.Node(ds.lists[0].node) {
+		return false
+	}
+	i := len(ds.lists) - 1
+	for i >= 0 && ds.lists[i].level >= level {
+		i--
+	}
+	if i < 0 {
+		return false
+	}
+	item := ds.lists[i].node.Items[len(ds.lists[i].node.Items)-1]
+	if i+1 < len(ds.lists) && ds.lists[i+1].level == level {
+		if sib := ds.lists[i+1].node; len(item.Nodes) > 0 && item.Nodes[len(item.Nodes)-1] == types.Node(sib) {
+			sib.Items = append(sib.Items, l.Items...)
+			ds.lists = ds.lists[:i+2]
+			return true
+		}
+	}
+	item.Append(l)
+	ds.lists = append(ds.lists[:i+1], &nestedList{l, level})
+	return true
+}
+
+// continueList returns the start number of numbered list ds.cur of class key,
+// given the start attribute of the element, which is zero if not present.
+// It returns zero for a list starting at 1 without an explicit start attribute.
+// A list which is not marked with the "start" class continues the numbering
+// of the previous list with the same class. A list also restarts the numbering
+// of its own nested levels.
+func (ds *docState) continueList(key string, start int) int {
+	if ds.listItems == nil {
+		ds.listItems = make(map[string]int)
+	}
+	n := ds.listItems[key]
+	if hasClass(ds.cur, "start") {
+		n = 0
+	}
+	if start > 0 {
+		n = start - 1
+	}
+	if i := strings.LastIndex(key, "-"); i > 0 {
+		level, _ := strconv.Atoi(key[i+1:])
+		for k := range ds.listItems {
+			j := strings.LastIndex(k, "-")
+			if l, err := strconv.Atoi(k[j+1:]); err == nil && k[:j] == key[:i] && l > level {
+				delete(ds.listItems, k)
+			}
+		}
+	}
+	if n == 0 && start == 0 {
+		return 0
+	}
+	return n + 1
+}
+
 // newStep creates a new codelab step from ds.cur
 // and finalizes nodes of the previous step.
 func newStep(ds *docState) {
@@ -371,9 +527,13 @@ func newStep(ds *docState) {
 	if t == "" {
 		return
 	}
-	finalizeStep(ds.step, ds.flags&fSkipImport == 0)
+	finalizeStep(ds)
 	ds.step = ds.clab.NewStep(t)
+	ds.step.Pos = types.Pos{Path: nodePath(ds.cur)}
 	ds.env = nil
+	ds.codeLang, ds.codeCell = "", nil
+	// lists of a step neither continue nor nest lists of the previous one
+	ds.lastNode, ds.lists, ds.listItems = nil, nil, nil
 }
 
 // metaTable parses the top <table> of a codelab doc
@@ -383,9 +543,11 @@ func metaTable(ds *docState) {
 			continue
 		}
 		s := stringifyNode(tr.FirstChild.NextSibling, true)
-		switch strings.ToLower(stringifyNode(tr.FirstChild, true)) {
+		k := strings.ToLower(stringifyNode(tr.FirstChild, true))
+		switch k {
 		case "id", "url":
 			ds.clab.ID = s
+			ds.derivedID = false
 		case "author":
 			ds.clab.Author = s
 		case "summary":
@@ -404,6 +566,14 @@ func metaTable(ds *docState) {
 			ds.clab.Feedback = s
 		case "analytics", "analytics account", "google analytics":
 			ds.clab.GA = s
+		default:
+			if k == "" {
+				continue
+			}
+			if ds.clab.Extra == nil {
+				ds.clab.Extra = make(map[string]string)
+			}
+			ds.clab.Extra[k] = s
 		}
 	}
 	if len(ds.clab.Categories) > 0 {
@@ -413,20 +583,23 @@ func metaTable(ds *docState) {
 
 // metaStep parses a codelab step meta instructions.
 func metaStep(ds *docState) {
+	pos := types.Pos{Path: nodePath(ds.cur)}
 	var text string
 	for {
 		text += stringifyNode(ds.cur, false)
-		if ds.cur.NextSibling == nil || !isMeta(ds.css, ds.cur.NextSibling) {
+		if ds.cur.NextSibling == nil || !isMeta(ds.css, ds.profile, ds.cur.NextSibling) {
 			break
 		}
 		ds.cur = ds.cur.NextSibling
 	}
 	meta := strings.SplitN(strings.TrimSpace(text), metaSep, 2)
 	if len(meta) != 2 {
+		ds.warn(types.SeverityWarning, pos, "step instruction %q is not of the form key: value", strings.TrimSpace(text))
 		return
 	}
+	key := strings.ToLower(strings.TrimSpace(meta[0]))
 	value := strings.TrimSpace(meta[1])
-	switch strings.ToLower(strings.TrimSpace(meta[0])) {
+	switch key {
 	case metaDuration:
 		parts := strings.SplitN(value, ":", len(durFactor))
 		if len(parts) == 1 {
@@ -436,6 +609,7 @@ func metaStep(ds *docState) {
 		for i, v := range parts {
 			vi, err := strconv.Atoi(v)
 			if err != nil {
+				ds.warn(types.SeverityWarning, pos, "invalid step duration %q", value)
 				continue
 			}
 			d += time.Duration(vi) * durFactor[len(durFactor)-len(parts)+i]
@@ -450,6 +624,10 @@ func metaStep(ds *docState) {
 		if ds.lastNode != nil && types.IsHeader(ds.lastNode.Type()) {
 			ds.lastNode.MutateEnv(ds.env)
 		}
+	case metaLanguage:
+		ds.codeLang, ds.codeCell = strings.ToLower(value), nil
+	default:
+		ds.warn(types.SeverityWarning, pos, "unknown step instruction %q", key)
 	}
 }
 
@@ -488,7 +666,7 @@ func infobox(ds *docState) types.Node {
 		return nil
 	}
 	kind := types.InfoboxPositive
-	if isInfoboxNegative(ds.css, ds.cur) {
+	if isInfoboxNegative(ds.css, ds.profile, ds.cur) {
 		kind = types.InfoboxNegative
 	}
 	return types.NewInfoboxNode(kind, nn...)
@@ -613,6 +791,11 @@ func code(ds *docState, term bool) types.Node {
 	}
 	n := types.NewCodeNode(v, term)
 	n.MutateBlock(td)
+	// a language hint applies to the lines of the first code block following it
+	if ds.codeLang != "" && (ds.codeCell == nil || ds.codeCell == td) {
+		ds.codeCell = td
+		n.Lang = ds.codeLang
+	}
 	return n
 }
 
@@ -624,6 +807,10 @@ func list(ds *docState) types.Node {
 		typ = "1"
 	}
 	start, _ := strconv.Atoi(nodeAttr(ds.cur, "start"))
+	key := listClass(ds.cur)
+	if ds.cur.DataAtom == atom.Ol && key != "" {
+		start = ds.continueList(key, start)
+	}
 	list := types.NewItemsListNode(typ, start)
 	for hn := findAtom(ds.cur, atom.Li); hn != nil; hn = hn.NextSibling {
 		if hn.DataAtom != atom.Li {
@@ -640,6 +827,21 @@ func list(ds *docState) types.Node {
 	if len(list.Items) == 0 {
 		return nil
 	}
+	if ds.cur.DataAtom == atom.Ol && key != "" {
+		n := len(list.Items)
+		if start > 0 {
+			n += start - 1
+		}
+		ds.listItems[key] = n
+	}
+	// Docs exports nested lists as sibling lists with a deeper level.
+	if ds.cur.Parent != nil && ds.cur.Parent.DataAtom == atom.Body {
+		level := listLevel(ds.css, ds.cur)
+		if ds.nestList(list, level) {
+			return nil
+		}
+		ds.lists = []*nestedList{{list, level}}
+	}
 	if ds.lastNode != nil {
 		switch ds.lastNode.Type() {
 		case types.NodeHeaderCheck:
@@ -660,11 +862,19 @@ func image(ds *docState) types.Node {
 	}
 	s := nodeAttr(ds.cur, "src")
 	if s == "" {
+		ds.warn(types.SeverityWarning, types.Pos{Path: nodePath(ds.cur)}, "image without source ignored")
 		return nil
 	}
 	n := types.NewImageNode(s)
+	n.Alt = nodeAttr(ds.cur, "alt")
+	n.Title = nodeAttr(ds.cur, "title")
 	n.MaxWidth = styleFloatValue(ds.cur, "width")
-	n.MutateBlock(findBlockParent(ds.cur))
+	n.MaxHeight = styleFloatValue(ds.cur, "height")
+	bp := findBlockParent(ds.cur)
+	// images among text in the same paragraph are inline, e.g. icons in an instruction
+	n.Inline = bp != nil && strings.TrimSpace(stringifyNode(bp, true)) != ""
+	n.Align = imageAlign(ds.css, ds.cur, bp, n.Inline)
+	n.MutateBlock(bp)
 	return n
 }
 
@@ -733,9 +943,14 @@ func link(ds *docState) types.Node {
 	if ds.flags&fMakeItalic != 0 || isItalic(ds.css, ds.cur.Parent) {
 		t.Italic = true
 	}
-	if ds.flags&fMakeCode != 0 || isCode(ds.css, ds.cur.Parent) {
+	if ds.flags&fMakeCode != 0 || isCode(ds.css, ds.profile, ds.cur.Parent) {
 		t.Code = true
 	}
+	t.Underline = isUnderline(ds.css, ds.cur.Parent)
+	t.Strikethrough = isStrikethrough(ds.css, ds.cur.Parent)
+	t.Superscript = isSuperscript(ds.css, ds.cur.Parent)
+	t.Subscript = isSubscript(ds.css, ds.cur.Parent)
+	t.Role = textRole(ds.css, ds.profile, ds.cur.Parent)
 	if href == "" || href[0] == '#' {
 		t.MutateBlock(findBlockParent(ds.cur))
 		return t
@@ -755,7 +970,7 @@ func link(ds *docState) types.Node {
 func text(ds *docState) types.Node {
 	bold := isBold(ds.css, ds.cur)
 	italic := isItalic(ds.css, ds.cur)
-	code := isCode(ds.css, ds.cur) || isConsole(ds.css, ds.cur)
+	code := isCode(ds.css, ds.profile, ds.cur) || isConsole(ds.css, ds.profile, ds.cur)
 
 	// TODO: verify whether this actually does anything
 	if a := findAtom(ds.cur, atom.A); a != nil {
@@ -783,6 +998,11 @@ func text(ds *docState) types.Node {
 	n.Bold = bold
 	n.Italic = italic
 	n.Code = code
+	n.Underline = isUnderline(ds.css, ds.cur)
+	n.Strikethrough = isStrikethrough(ds.css, ds.cur)
+	n.Superscript = isSuperscript(ds.css, ds.cur)
+	n.Subscript = isSubscript(ds.css, ds.cur)
+	n.Role = textRole(ds.css, ds.profile, ds.cur)
 	n.MutateBlock(findBlockParent(ds.cur))
 	return n
 }
@@ -24,6 +24,7 @@ import (
 
 	"golang.org/x/net/html"
 
+	"github.com/CloudVLab/tools/claat/parser"
 	"github.com/CloudVLab/tools/claat/render"
 	"github.com/CloudVLab/tools/claat/types"
 )
@@ -77,9 +78,10 @@ func TestParseStepDuration(t *testing.T) {
 			t.Errorf("%d: Parse(%q): %v", i, test.markup, err)
 		}
 		ds := &docState{
-			step: &types.Step{Content: types.NewListNode()},
-			css:  cssStyle{".c9": {"color": metaColor}},
-			cur:  doc.FirstChild,
+			step:    &types.Step{Content: types.NewListNode()},
+			css:     cssStyle{".c9": {"color": DefaultProfile().MetaColor}},
+			profile: DefaultProfile(),
+			cur:     doc.FirstChild,
 		}
 		parseTop(ds)
 		if ds.step.Duration != test.dur {
@@ -119,10 +121,11 @@ func TestParseTopCodeBlock(t *testing.T) {
 	ds := &docState{
 		step: &types.Step{Content: types.NewListNode()},
 		css: cssStyle{
-			".code": {"font-family": fontCode},
-			".term": {"font-family": fontConsole},
+			".code": {"font-family": DefaultProfile().CodeFont},
+			".term": {"font-family": DefaultProfile().ConsoleFont},
 		},
-		cur: doc.FirstChild,
+		profile: DefaultProfile(),
+		cur:     doc.FirstChild,
 	}
 	parseTop(ds)
 
@@ -168,13 +171,17 @@ func TestMetaTable(t *testing.T) {
 				<td>Analytics</td>
 				<td>GA-12345</td>
 			</tr>
+			<tr>
+				<td>Credit Cost</td>
+				<td>5</td>
+			</tr>
 		</table>
 	</body>
 	</html>
 	`
 
 	p := &Parser{}
-	clab, err := p.Parse(markupReader(markup))
+	clab, err := p.Parse(markupReader(markup), true)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -186,6 +193,7 @@ func TestMetaTable(t *testing.T) {
 		Status:     clab.Meta.Status, // verified separately
 		Feedback:   "https://example.com/issues",
 		GA:         "GA-12345",
+		Extra:      map[string]string{"credit cost": "5"},
 		// Tags are always sorted.
 		// TODO: move sorting to Parse of the parser package
 		Tags: []string{"kiosk", "web"},
@@ -288,7 +296,7 @@ func TestParseDoc(t *testing.T) {
 	`
 
 	p := &Parser{}
-	c, err := p.Parse(markupReader(markup))
+	c, err := p.Parse(markupReader(markup), true)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -329,6 +337,8 @@ func TestParseDoc(t *testing.T) {
 
 	img = types.NewImageNode("https://host/small.png")
 	img.MaxWidth = 25.5
+	img.MaxHeight = 10
+	img.Inline = true
 	para = types.NewListNode(img, types.NewTextNode(" icon."))
 	para.MutateBlock(true)
 	content.Append(para)
@@ -451,10 +461,13 @@ func TestParseFragment(t *testing.T) {
 	`
 
 	p := &Parser{}
-	nodes, err := p.ParseFragment(markupReader(markup))
+	nodes, warn, err := p.ParseFragment(markupReader(markup), true)
 	if err != nil {
 		t.Fatal(err)
 	}
+	if len(warn) != 0 {
+		t.Errorf("ParseFragment warnings: %v", warn)
+	}
 
 	var want []types.Node
 
@@ -479,3 +492,411 @@ func TestParseFragment(t *testing.T) {
 		t.Errorf("nodes:\n\n%s\nwant:\n\n%s", html1, html2)
 	}
 }
+
+func TestParsePositions(t *testing.T) {
+	const markup = `
+	<html><body>
+		<p class="title"><span>Positions</span></p>
+		<h1>First step</h1>
+		<p><span>Some text</span></p>
+		<h1>Second step</h1>
+		<p><span>One</span></p>
+		<h3>Header</h3>
+	</body></html>
+	`
+	p := &Parser{}
+	clab, err := p.Parse(markupReader(markup), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(clab.Steps) != 2 {
+		t.Fatalf("len(clab.Steps) = %d; want 2", len(clab.Steps))
+	}
+	if pos := clab.Steps[1].Pos.String(); pos != "body/h1[2]" {
+		t.Errorf("step pos = %q; want %q", pos, "body/h1[2]")
+	}
+	nodes := clab.Steps[1].Content.Nodes
+	if len(nodes) != 2 {
+		t.Fatalf("len(nodes) = %d; want 2", len(nodes))
+	}
+	want := []string{"body/p[3]", "body/h3[1]"}
+	for i, n := range nodes {
+		if pos := n.Pos().String(); pos != want[i] {
+			t.Errorf("%d: %T pos = %q; want %q", i, n, pos, want[i])
+		}
+	}
+}
+
+func TestParseWarnings(t *testing.T) {
+	const markup = `
+	<html><head><style>
+		.meta { color: #b7b7b7 }
+		.bold { font-weight: bold }
+	</style></head>
+	<body>
+		<p class="title"><span>Warnings</span></p>
+		<h1>First step</h1>
+		<p><span class="meta">Duration: 1:xx</span></p>
+		<p><span class="meta">Level: easy</span></p>
+		<p><span>[[</span><span class="bold">unknown</span><a href="https://example.com">thing</a><span>]]</span></p>
+		<p><img src=""></p>
+	</body></html>
+	`
+	p := &Parser{}
+	clab, err := p.Parse(markupReader(markup), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out []string
+	for _, w := range clab.Warnings {
+		out = append(out, w.Severity.String()+" "+w.String())
+	}
+	want := []string{
+		`warn body/p[2]/span[1]: invalid step duration "1:xx"`,
+		`warn body/p[3]/span[1]: unknown step instruction "level"`,
+		`warn body/p[5]/img[1]: image without source ignored`,
+		`warn body/p[4]: unknown directive [[unknown]]`,
+		`info missing codelab ID, derived from the title`,
+	}
+	if !reflect.DeepEqual(out, want) {
+		t.Errorf("clab.Warnings:\n%q\nwant:\n%q", out, want)
+	}
+}
+
+func TestRegisteredDirective(t *testing.T) {
+	parser.RegisterDirective("gdoc-test", func(d *parser.Directive) (types.Node, error) {
+		return types.NewInfoboxNode(types.InfoboxNote, d.Args...), nil
+	})
+	const markup = `
+	<html><head><style>
+		.bold { font-weight: bold }
+	</style></head>
+	<body>
+		<p class="title"><span>Directives</span></p>
+		<h1>First step</h1>
+		<p><span>[[</span><span class="bold">gdoc-test</span><a href="https://example.com">link</a><span>]]</span></p>
+	</body></html>
+	`
+	clab, err := (&Parser{}).Parse(markupReader(markup), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodes := clab.Steps[0].Content.Nodes
+	if len(nodes) != 1 {
+		t.Fatalf("len(nodes) = %d; want 1", len(nodes))
+	}
+	box, ok := nodes[0].(*types.InfoboxNode)
+	if !ok {
+		t.Fatalf("nodes[0] = %T; want *types.InfoboxNode", nodes[0])
+	}
+	if len(box.Content.Nodes) != 1 || box.Content.Nodes[0].Type() != types.NodeURL {
+		t.Errorf("box.Content.Nodes = %+v; want a link", box.Content.Nodes)
+	}
+	if pos := box.Pos().String(); pos != "body/p[2]" {
+		t.Errorf("box pos = %q; want %q", pos, "body/p[2]")
+	}
+}
+
+func TestContinuedList(t *testing.T) {
+	const markup = `
+	<html><body>
+		<p class="title"><span>Lists</span></p>
+		<h1>Step</h1>
+		<ol class="c1 lst-kix_a-0 start" start="1"><li><span>One</span></li><li><span>Two</span></li></ol>
+		<p><img src="https://host/one.png"></p>
+		<ol class="c1 lst-kix_a-1 start" start="1"><li><span>Nested</span></li></ol>
+		<p><img src="https://host/two.png"></p>
+		<ol class="c1 lst-kix_a-0"><li><span>Three</span></li></ol>
+		<p><img src="https://host/three.png"></p>
+		<ol class="c1 lst-kix_a-1"><li><span>Nested again</span></li></ol>
+		<p><img src="https://host/four.png"></p>
+		<ol class="c1 lst-kix_a-0" start="5"><li><span>Five</span></li></ol>
+		<p><img src="https://host/five.png"></p>
+		<ol class="c1 lst-kix_b-0 start" start="1"><li><span>Other list</span></li></ol>
+	</body></html>
+	`
+	clab, err := (&Parser{}).Parse(markupReader(markup), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var start []int
+	for _, n := range clab.Steps[0].Content.Nodes {
+		if l, ok := n.(*types.ItemsListNode); ok {
+			start = append(start, l.Start)
+		}
+	}
+	want := []int{1, 1, 3, 0, 5, 1}
+	if !reflect.DeepEqual(start, want) {
+		t.Errorf("list starts = %v; want %v", start, want)
+	}
+}
+
+func TestNestedList(t *testing.T) {
+	const markup = `
+	<html><head><style>
+		.c1 { margin-left: 36pt }
+		.c2 { margin-left: 72pt }
+	</style></head>
+	<body>
+		<p class="title"><span>Lists</span></p>
+		<h1>Step</h1>
+		<ol class="lst-kix_a-0 start" start="1"><li><span>One</span></li></ol>
+		<ul class="lst-kix_b-1 start"><li><span>One A</span></li></ul>
+		<ul class="lst-kix_b-2 start"><li><span>One A i</span></li></ul>
+		<ul class="lst-kix_b-1"><li><span>One B</span></li></ul>
+		<ol class="lst-kix_a-0"><li><span>Two</span></li></ol>
+		<ul><li class="c2"><span>Two A</span></li></ul>
+		<p><span>Paragraph</span></p>
+		<ul class="lst-kix_c-1 start"><li><span>Not nested</span></li></ul>
+	</body></html>
+	`
+	clab, err := (&Parser{}).Parse(markupReader(markup), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	item := func(s string, nested ...types.Node) []types.Node {
+		return append([]types.Node{types.NewTextNode(s)}, nested...)
+	}
+	one3 := types.NewItemsListNode("", 0)
+	one3.NewItem(item("One A i")...)
+	one2 := types.NewItemsListNode("", 0)
+	one2.NewItem(item("One A", one3)...)
+	one2.NewItem(item("One B")...)
+	two2 := types.NewItemsListNode("", 0)
+	two2.NewItem(item("Two A")...)
+	list := types.NewItemsListNode("1", 1)
+	list.NewItem(item("One", one2)...)
+	list.NewItem(item("Two", two2)...)
+	para := types.NewListNode(types.NewTextNode("Paragraph"))
+	para.MutateBlock(true)
+	flat := types.NewItemsListNode("", 0)
+	flat.NewItem(item("Not nested")...)
+
+	html1, _ := render.HTML("", clab.Steps[0].Content.Nodes...)
+	html2, _ := render.HTML("", list, para, flat)
+	if html1 != html2 {
+		t.Errorf("step content:\n\n%s\nwant:\n\n%s", html1, html2)
+	}
+}
+
+func TestStepLists(t *testing.T) {
+	const markup = `
+	<html><body>
+		<p class="title"><span>Lists</span></p>
+		<h1>One</h1>
+		<ol class="lst-kix_a-0 start" start="1"><li><span>One</span></li><li><span>Two</span></li></ol>
+		<h1>Two</h1>
+		<ul class="lst-kix_b-1 start"><li><span>Not nested</span></li></ul>
+		<ol class="lst-kix_a-0"><li><span>Not continued</span></li></ol>
+	</body></html>
+	`
+	clab, err := (&Parser{}).Parse(markupReader(markup), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(clab.Steps) != 2 {
+		t.Fatalf("len(clab.Steps) = %d; want 2", len(clab.Steps))
+	}
+	item := func(s string) []types.Node {
+		return []types.Node{types.NewTextNode(s)}
+	}
+	one := types.NewItemsListNode("1", 1)
+	one.NewItem(item("One")...)
+	one.NewItem(item("Two")...)
+	flat := types.NewItemsListNode("", 0)
+	flat.NewItem(item("Not nested")...)
+	restarted := types.NewItemsListNode("1", 0)
+	restarted.NewItem(item("Not continued")...)
+
+	for i, want := range [][]types.Node{{one}, {flat, restarted}} {
+		html1, _ := render.HTML("", clab.Steps[i].Content.Nodes...)
+		html2, _ := render.HTML("", want...)
+		if html1 != html2 {
+			t.Errorf("step %d content:\n\n%s\nwant:\n\n%s", i+1, html1, html2)
+		}
+	}
+}
+
+func TestImageCaption(t *testing.T) {
+	const markup = `
+	<html><head><style>
+		.ita { font-style: italic }
+	</style></head>
+	<body>
+		<p class="title"><span>Images</span></p>
+		<h1>Step</h1>
+		<p><img alt="Cloud Shell" title="Activate Cloud Shell" src="https://host/shell.png"></p>
+		<p><span class="ita">The Cloud Shell button</span></p>
+		<p><img alt="Editor" src="https://host/editor.png"></p>
+		<p><span>Regular text.</span></p>
+	</body></html>
+	`
+	clab, err := (&Parser{}).Parse(markupReader(markup), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img := types.NewImageNode("https://host/shell.png")
+	img.Alt = "Cloud Shell"
+	img.Title = "Activate Cloud Shell"
+	img.Caption = "The Cloud Shell button"
+	fig := types.NewListNode(img)
+	fig.MutateBlock(true)
+	img2 := types.NewImageNode("https://host/editor.png")
+	img2.Alt = "Editor"
+	para := types.NewListNode(img2)
+	para.MutateBlock(true)
+	text := types.NewListNode(types.NewTextNode("Regular text."))
+	text.MutateBlock(true)
+
+	html1, _ := render.HTML("", clab.Steps[0].Content.Nodes...)
+	html2, _ := render.HTML("", fig, para, text)
+	if html1 != html2 {
+		t.Errorf("step content:\n\n%s\nwant:\n\n%s", html1, html2)
+	}
+}
+
+func TestImageLayout(t *testing.T) {
+	const markup = `
+	<html><head><style>
+		.center { text-align: center }
+	</style></head>
+	<body>
+		<p class="title"><span>Images</span></p>
+		<h1>Step</h1>
+		<p class="center"><span><img src="https://host/centered.png" style="width: 300px; height: 200px"></span></p>
+		<p><span style="float: right"><img src="https://host/right.png"></span><span>Text wrapping around.</span></p>
+		<p class="center"><span>Click </span><span><img src="https://host/icon.png" style="width: 16px; height: 16px"></span><span> to run.</span></p>
+	</body></html>
+	`
+	clab, err := (&Parser{}).Parse(markupReader(markup), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var images []*types.ImageNode
+	for _, n := range clab.Steps[0].Content.Nodes {
+		for _, cn := range n.(*types.ListNode).Nodes {
+			if img, ok := cn.(*types.ImageNode); ok {
+				images = append(images, img)
+			}
+		}
+	}
+	tests := []struct {
+		width, height float32
+		align         types.ImageAlign
+		inline        bool
+	}{
+		{300, 200, types.ImageAlignCenter, false},
+		{0, 0, types.ImageAlignRight, true},
+		{16, 16, "", true},
+	}
+	if len(images) != len(tests) {
+		t.Fatalf("%d images; want %d", len(images), len(tests))
+	}
+	for i, tc := range tests {
+		img := images[i]
+		if img.MaxWidth != tc.width || img.MaxHeight != tc.height || img.Align != tc.align || img.Inline != tc.inline {
+			t.Errorf("%d: size = %vx%v, align = %q, inline = %v; want %vx%v, %q, %v", i,
+				img.MaxWidth, img.MaxHeight, img.Align, img.Inline, tc.width, tc.height, tc.align, tc.inline)
+		}
+	}
+}
+
+func TestTextStyles(t *testing.T) {
+	const markup = `
+	<html><head><style>
+		.strike { text-decoration: line-through }
+		.under { text-decoration: underline }
+		.sup { vertical-align: super }
+		.sub { vertical-align: sub }
+	</style></head>
+	<body>
+		<p class="title"><span>Styles</span></p>
+		<h1>Step</h1>
+		<p><span>H</span><span class="sub">2</span><span>O is </span><span class="strike">v1</span><span> v2, x</span><span class="sup">2</span><span> and </span><span class="under">that</span><span>.</span></p>
+		<p><span class="under"><a href="https://example.com">link</a></span></p>
+		<p><span class="strike"><a href="https://example.com">old</a></span></p>
+	</body></html>
+	`
+	clab, err := (&Parser{}).Parse(markupReader(markup), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "<p>H<sub>2</sub>O is <s>v1</s> v2, x<sup>2</sup> and <u>that</u>.</p>\n" +
+		"<p><a href=\"https://example.com\" target=\"_blank\"><u>link</u></a></p>\n" +
+		"<p><a href=\"https://example.com\" target=\"_blank\"><s>old</s></a></p>\n"
+	h, _ := render.HTML("", clab.Steps[0].Content.Nodes...)
+	if v := string(h); v != want {
+		t.Errorf("step content = %q; want %q", v, want)
+	}
+}
+
+func TestTextRoles(t *testing.T) {
+	const markup = `
+	<html><head><style>
+		.ph { background-color: #fff2cc }
+		.ui { background-color: #d9d2e9; font-weight: bold }
+	</style></head>
+	<body>
+		<p class="title"><span>Roles</span></p>
+		<h1>Step</h1>
+		<p><span>Replace </span><span class="ph">PROJECT_</span><span class="ph">ID</span><span> and click </span><span class="ui">Save</span><span>.</span></p>
+	</body></html>
+	`
+	clab, err := (&Parser{}).Parse(markupReader(markup), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<p>Replace <span class="placeholder">PROJECT_ID</span> and click <span class="ui"><strong>Save</strong></span>.</p>` + "\n"
+	h, _ := render.HTML("", clab.Steps[0].Content.Nodes...)
+	if v := string(h); v != want {
+		t.Errorf("step content = %q; want %q", v, want)
+	}
+}
+
+func TestCodeLangHint(t *testing.T) {
+	const markup = `
+	<html><head><style>
+		.meta { color: #b7b7b7 }
+		.code { font-family: "Courier New" }
+		.term { font-family: "Consolas" }
+	</style></head>
+	<body>
+		<p class="title"><span>Code</span></p>
+		<table><tbody><tr><td><p>ID</p></td><td><p>code</p></td></tr></tbody></table>
+		<h1>Step</h1>
+		<p><span class="meta">Language: Kotlin</span></p>
+		<table><tbody><tr><td>
+			<p><span class="code">fun main() {</span></p>
+			<p><span class="code">}</span></p>
+		</td></tr></tbody></table>
+		<table><tbody><tr><td>
+			<p><span class="code">package main</span></p>
+		</td></tr></tbody></table>
+		<table><tbody><tr><td>
+			<p><span class="code">x = 1</span></p>
+		</td></tr></tbody></table>
+		<table><tbody><tr><td>
+			<p><span class="term">gcloud init</span></p>
+		</td></tr></tbody></table>
+	</body></html>
+	`
+	clab, err := (&Parser{}).Parse(markupReader(markup), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(clab.Warnings) != 0 {
+		t.Errorf("warnings: %v", clab.Warnings)
+	}
+	var langs []string
+	for _, n := range clab.Steps[0].Content.Nodes {
+		if c, ok := n.(*types.CodeNode); ok {
+			langs = append(langs, c.Lang)
+		}
+	}
+	want := []string{"kotlin", "go", "", ""}
+	if !reflect.DeepEqual(langs, want) {
+		t.Errorf("code languages = %q; want %q", langs, want)
+	}
+}
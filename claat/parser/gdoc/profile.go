@@ -0,0 +1,75 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gdoc
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+// StyleProfile is a set of style conventions of a codelab doc template,
+// which the parser relies on to recognize codelab elements such as code blocks
+// or info boxes. Colors are in lower case hex notation, e.g. "#b7b7b7",
+// and fonts are lower case font family names, e.g. "courier new".
+type StyleProfile struct {
+	MetaColor        string `json:"meta_color"`        // step meta instruction text
+	ButtonColor      string `json:"button_color"`      // button background
+	CodeFont         string `json:"code_font"`         // source code
+	ConsoleFont      string `json:"console_font"`      // terminal commands
+	PositiveColor    string `json:"positive_color"`    // positive infobox background
+	NegativeColor    string `json:"negative_color"`    // negative infobox background
+	SurveyColor      string `json:"survey_color"`      // survey background
+	PlaceholderColor string `json:"placeholder_color"` // placeholder value background
+	UIColor          string `json:"ui_color"`          // user interface element background
+}
+
+// DefaultProfile returns the style profile of the standard codelab doc template.
+// Every call returns a new profile, which the caller may modify.
+func DefaultProfile() *StyleProfile {
+	return &StyleProfile{
+		MetaColor:        "#b7b7b7",
+		ButtonColor:      "#6aa84f",
+		CodeFont:         "courier new",
+		ConsoleFont:      "consolas",
+		PositiveColor:    "#d9ead3",
+		NegativeColor:    "#fce5cd",
+		SurveyColor:      "#cfe2f3",
+		PlaceholderColor: "#fff2cc", // light yellow 3
+		UIColor:          "#d9d2e9", // light purple 3
+	}
+}
+
+// ReadProfile reads a style profile in JSON format from r, e.g.
+//
+//	{"code_font": "Roboto Mono", "console_font": "Source Code Pro"}
+//
+// Conventions missing from r are those of the default profile.
+// Colors and fonts are converted to lower case.
+func ReadProfile(r io.Reader) (*StyleProfile, error) {
+	p := DefaultProfile()
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(p); err != nil {
+		return nil, err
+	}
+	for _, v := range []*string{
+		&p.MetaColor, &p.ButtonColor, &p.CodeFont, &p.ConsoleFont, &p.PositiveColor,
+		&p.NegativeColor, &p.SurveyColor, &p.PlaceholderColor, &p.UIColor,
+	} {
+		*v = strings.ToLower(strings.TrimSpace(*v))
+	}
+	return p, nil
+}
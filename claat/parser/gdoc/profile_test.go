@@ -0,0 +1,71 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gdoc
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/CloudVLab/tools/claat/render"
+)
+
+func TestReadProfile(t *testing.T) {
+	p, err := ReadProfile(strings.NewReader(`{"code_font": " Roboto Mono ", "ui_color": "#FCE5CD"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := DefaultProfile()
+	want.CodeFont = "roboto mono"
+	want.UIColor = "#fce5cd"
+	if !reflect.DeepEqual(p, want) {
+		t.Errorf("ReadProfile = %+v; want %+v", p, want)
+	}
+
+	for _, s := range []string{`{"code_fonts": "arial"}`, `{"code_font": 1}`, `code_font`} {
+		if _, err := ReadProfile(strings.NewReader(s)); err == nil {
+			t.Errorf("ReadProfile(%s) returned no error", s)
+		}
+	}
+}
+
+func TestParseProfile(t *testing.T) {
+	const markup = `
+	<html><head><style>
+		.code { font-family: "Roboto Mono" }
+		.old { font-family: "Courier New" }
+		.ph { background-color: #fce5cd }
+	</style></head>
+	<body>
+		<p class="title"><span>Profile</span></p>
+		<h1>Step</h1>
+		<p><span class="code">x := 1</span></p>
+		<p><span>Replace </span><span class="ph">NAME</span><span> in </span><span class="old">main.go</span><span>.</span></p>
+	</body></html>
+	`
+	sp := DefaultProfile()
+	sp.CodeFont = "roboto mono"
+	sp.PlaceholderColor = "#fce5cd"
+	clab, err := (&Parser{Profile: sp}).Parse(markupReader(markup), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "<p><code>x := 1</code></p>\n" +
+		`<p>Replace <span class="placeholder">NAME</span> in main.go.</p>` + "\n"
+	h, _ := render.HTML("", clab.Steps[0].Content.Nodes...)
+	if v := string(h); v != want {
+		t.Errorf("step content = %q; want %q", v, want)
+	}
+}
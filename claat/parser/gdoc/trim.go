@@ -18,6 +18,8 @@ import (
 	"strings"
 	"unicode"
 
+	"golang.org/x/net/html"
+
 	"github.com/CloudVLab/tools/claat/types"
 )
 
@@ -49,6 +51,12 @@ func squashHeadBlock(nodes []types.Node) (squash, remainder []types.Node) {
 	head := types.NewListNode(hnodes...)
 	head.MutateBlock(true)
 	head.MutateEnv(first.Env())
+	// the block is located at its parent element, if known
+	if hn, ok := first.Block().(*html.Node); ok {
+		head.MutatePos(types.Pos{Path: nodePath(hn)})
+	} else {
+		head.MutatePos(first.Pos())
+	}
 	return []types.Node{head}, next
 }
 
@@ -125,8 +133,11 @@ func concatText(a, b types.Node) bool {
 		t1.Value += t2.Value
 		return true
 	}
-	// different text styles: bold, italic or code
-	if t1.Code != t2.Code || t1.Bold != t2.Bold || t1.Italic != t2.Italic {
+	// different text styles: bold, italic, code, decorations or roles
+	if t1.Code != t2.Code || t1.Bold != t2.Bold || t1.Italic != t2.Italic ||
+		t1.Strikethrough != t2.Strikethrough || t1.Underline != t2.Underline ||
+		t1.Superscript != t2.Superscript || t1.Subscript != t2.Subscript ||
+		t1.Role != t2.Role {
 		return false
 	}
 	// everything else can be concatenated
@@ -0,0 +1,96 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parser
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// LangGuesser guesses the language of a code block from its content.
+// It returns an empty string if the language could not be guessed.
+type LangGuesser func(code string) string
+
+var (
+	guessersMu sync.Mutex // guards guessers
+	guessers   []LangGuesser
+)
+
+// RegisterLangGuesser registers a code language guesser, used by parsers
+// for code blocks written without a language hint.
+// Guessers are tried in the order they are registered,
+// followed by the guesser built into CLaaT.
+func RegisterLangGuesser(g LangGuesser) {
+	guessersMu.Lock()
+	defer guessersMu.Unlock()
+	guessers = append(guessers, g)
+}
+
+// GuessCodeLang returns the language of code, as guessed by the first
+// registered guesser to recognize it. It returns an empty string if none did.
+func GuessCodeLang(code string) string {
+	guessersMu.Lock()
+	gg := append([]LangGuesser{}, guessers...)
+	guessersMu.Unlock()
+	for _, g := range append(gg, guessLang) {
+		if lang := g(code); lang != "" {
+			return lang
+		}
+	}
+	return ""
+}
+
+// langHints are the patterns of code recognized by guessLang, tried in order.
+// The language names are the same as those returned by CodeLang.
+var langHints = []struct {
+	lang string
+	re   *regexp.Regexp
+}{
+	{"bash", regexp.MustCompile(`^#!.*\b(ba|z)?sh\b`)},
+	{"python", regexp.MustCompile(`^#!.*\bpython`)},
+	{"javascript", regexp.MustCompile(`^#!.*\bnode\b`)},
+	{"php", regexp.MustCompile(`^<\?php\b`)},
+	{"xml", regexp.MustCompile(`^<\?xml\b`)},
+	{"html", regexp.MustCompile(`(?i)^<(!doctype html|html|head|body|div|script)\b`)},
+	{"go", regexp.MustCompile(`(?m)^package \w+$`)},
+	{"java", regexp.MustCompile(`(?m)^(package [\w.]+;|import java\.|public (final )?class \w+)`)},
+	{"cpp", regexp.MustCompile(`(?m)^#include [<"]`)},
+	{"python", regexp.MustCompile(`(?m)^(def \w+\(.*\):|from [\w.]+ import \w|import \w+$|if __name__ == )`)},
+	{"hcl", regexp.MustCompile(`(?m)^(resource|provider|variable|module|output|terraform)( "[^"]*")* \{`)},
+	{"yaml", regexp.MustCompile(`(?m)^(apiVersion|kind|runtime|steps):`)},
+	{"sql", regexp.MustCompile(`(?i)^(select .+ from |insert into |create (table|database|index|view) |update \w+ set )`)},
+	{"javascript", regexp.MustCompile(`(?m)^(const|let) \w+ = require\(|^function \w+\(.*\) \{|^module\.exports\b`)},
+	{"bash", regexp.MustCompile(`(?m)^(\$ )?(gcloud|gsutil|bq|kubectl|docker|sudo|apt-get|export|curl|mkdir|cd) `)},
+}
+
+// guessLang is the guesser built into CLaaT. It recognizes the few languages
+// of langHints, and JSON documents, erring on the side of no guess.
+func guessLang(code string) string {
+	code = strings.TrimSpace(code)
+	if code == "" {
+		return ""
+	}
+	if (code[0] == '{' || code[0] == '[') && json.Valid([]byte(code)) {
+		return "json"
+	}
+	for _, h := range langHints {
+		if h.re.MatchString(code) {
+			return h.lang
+		}
+	}
+	return ""
+}
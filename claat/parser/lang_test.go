@@ -0,0 +1,68 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parser
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGuessCodeLang(t *testing.T) {
+	tests := []struct{ in, out string }{
+		{"#!/bin/bash\necho hello", "bash"},
+		{"#!/usr/bin/env python3\nprint(1)", "python"},
+		{"\npackage main\n\nfunc main() {}\n", "go"},
+		{"package com.example;\n\npublic class App {}", "java"},
+		{"public class App {\n}", "java"},
+		{"#include <stdio.h>\nint main() {}", "cpp"},
+		{"import os\n\nprint(os.getcwd())", "python"},
+		{"def main():\n    pass", "python"},
+		{`{"name": "app", "version": 1}`, "json"},
+		{"[1, 2, 3]", "json"},
+		{"<!DOCTYPE html>\n<html></html>", "html"},
+		{"<?xml version=\"1.0\"?>\n<project/>", "xml"},
+		{"apiVersion: v1\nkind: Pod", "yaml"},
+		{"resource \"google_compute_instance\" \"vm\" {\n}", "hcl"},
+		{"SELECT name FROM users", "sql"},
+		{"const express = require('express');", "javascript"},
+		{"gcloud compute instances list", "bash"},
+		{"$ cd app", "bash"},
+		// no guess
+		{"", ""},
+		{"Hello, world!", ""},
+		{"{not json", ""},
+		{"x = 1", ""},
+	}
+	for _, tc := range tests {
+		if out := GuessCodeLang(tc.in); out != tc.out {
+			t.Errorf("GuessCodeLang(%q) = %q; want %q", tc.in, out, tc.out)
+		}
+	}
+}
+
+func TestRegisterLangGuesser(t *testing.T) {
+	RegisterLangGuesser(func(code string) string {
+		if strings.HasPrefix(code, "%%test") {
+			return "test"
+		}
+		return ""
+	})
+	if lang := GuessCodeLang("%%test\ncd app"); lang != "test" {
+		t.Errorf("GuessCodeLang = %q; want test", lang)
+	}
+	if lang := GuessCodeLang("cd app"); lang != "bash" {
+		t.Errorf("GuessCodeLang = %q; want bash", lang)
+	}
+}
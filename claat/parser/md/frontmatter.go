@@ -0,0 +1,312 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package md
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	yamlFrontMatter = "---" // YAML front matter delimiter
+	yamlDocumentEnd = "..." // alternative YAML front matter closing delimiter
+	tomlFrontMatter = "+++" // TOML front matter delimiter
+)
+
+// frontMatterKeyReplacer normalizes front matter keys to the form used
+// by the metadata paragraphs, e.g. feedback_link becomes "feedback link".
+var frontMatterKeyReplacer = strings.NewReplacer("_", " ", "-", " ")
+
+// frontMatterMetaKeys are the metadata keys which contain spaces,
+// and may thus be written with underscores or dashes in front matter.
+var frontMatterMetaKeys = map[string]bool{
+	metaFeedbackLink:     true,
+	metaAnalyticsAccount: true,
+}
+
+// splitFrontMatter separates an optional YAML or TOML front matter block from the rest of a Markdown document.
+// The block must start on the first line of b with "---" for YAML or "+++" for TOML, and end with the same
+// delimiter on a line by itself.
+//
+// It returns the metadata found in the front matter, in the same form as the metadata paragraphs
+// understood by parseMetadata, and the remaining document. List values are joined with commas.
+// The front matter is replaced with empty lines in the returned document, so that line numbers
+// are kept. Both the metadata and an error are nil if b has no front matter.
+func splitFrontMatter(b []byte) (map[string]string, []byte, error) {
+	b = bytes.TrimPrefix(b, []byte("\ufeff"))
+	lines := strings.Split(string(b), "\n")
+	delim := strings.TrimSpace(lines[0])
+	if delim != yamlFrontMatter && delim != tomlFrontMatter {
+		return nil, b, nil
+	}
+	for i := 1; i < len(lines); i++ {
+		l := strings.TrimSpace(lines[i])
+		if l != delim && !(delim == yamlFrontMatter && l == yamlDocumentEnd) {
+			continue
+		}
+		var (
+			m   map[string]string
+			err error
+		)
+		if delim == yamlFrontMatter {
+			m, err = parseYAMLFrontMatter(lines[1:i])
+		} else {
+			m, err = parseTOMLFrontMatter(lines[1:i])
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		rest := strings.Repeat("\n", i+1) + strings.Join(lines[i+1:], "\n")
+		return m, []byte(rest), nil
+	}
+	return nil, nil, fmt.Errorf("front matter: missing closing %q", delim)
+}
+
+// parseYAMLFrontMatter parses the subset of YAML found in front matter blocks:
+// top-level keys with plain or quoted scalars, "|" and ">" block scalars,
+// multi-line plain scalars, and flow or block sequences of scalars.
+func parseYAMLFrontMatter(lines []string) (map[string]string, error) {
+	m := map[string]string{}
+	for i := 0; i < len(lines); i++ {
+		l := strings.TrimRight(lines[i], " \t\r")
+		if t := strings.TrimSpace(l); t == "" || t[0] == '#' {
+			continue
+		}
+		if indent(l) > 0 {
+			return nil, fmt.Errorf("front matter line %d: unexpected indentation", i+1)
+		}
+		kv := strings.SplitN(l, ":", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("front matter line %d: invalid format: %q", i+1, l)
+		}
+		k := frontMatterKey(kv[0])
+		v := strings.TrimSpace(kv[1])
+
+		// Collect the indented lines which belong to this key.
+		var block []string
+		for i+1 < len(lines) {
+			n := strings.TrimRight(lines[i+1], " \t\r")
+			if strings.TrimSpace(n) != "" && indent(n) == 0 && !strings.HasPrefix(n, "- ") {
+				break
+			}
+			block = append(block, n)
+			i++
+		}
+		for len(block) > 0 && strings.TrimSpace(block[len(block)-1]) == "" {
+			block = block[:len(block)-1]
+		}
+
+		switch {
+		case strings.HasPrefix(v, "|") || strings.HasPrefix(v, ">"):
+			m[k] = yamlBlockScalar(v[0] == '|', block)
+		case strings.HasPrefix(v, "["):
+			items, err := flowList(strings.TrimSpace(v + " " + strings.Join(trimLines(block), " ")))
+			if err != nil {
+				return nil, fmt.Errorf("front matter line %d: %v", i+1, err)
+			}
+			m[k] = strings.Join(items, ", ")
+		case v == "" && len(block) > 0 && strings.HasPrefix(strings.TrimSpace(block[0]), "-"):
+			var items []string
+			for _, b := range trimLines(block) {
+				if b == "" {
+					continue
+				}
+				if !strings.HasPrefix(b, "-") {
+					return nil, fmt.Errorf("front matter key %q: nested values are not supported", k)
+				}
+				items = append(items, unquote(strings.TrimSpace(strings.TrimPrefix(b, "-"))))
+			}
+			m[k] = strings.Join(items, ", ")
+		case v == "" && len(block) > 0 && strings.Contains(block[0], ": "):
+			return nil, fmt.Errorf("front matter key %q: nested values are not supported", k)
+		default:
+			// Plain scalars may continue on the following indented lines.
+			parts := append([]string{v}, trimLines(block)...)
+			m[k] = unquote(strings.TrimSpace(strings.Join(parts, " ")))
+		}
+	}
+	return m, nil
+}
+
+// yamlBlockScalar returns the content of a block scalar. Literal scalars keep line breaks,
+// while folded scalars join lines with spaces, except for blank lines.
+func yamlBlockScalar(literal bool, block []string) string {
+	n := -1
+	for _, l := range block {
+		if strings.TrimSpace(l) == "" {
+			continue
+		}
+		if i := indent(l); n < 0 || i < n {
+			n = i
+		}
+	}
+	lines := make([]string, len(block))
+	for i, l := range block {
+		if n >= 0 && len(l) >= n {
+			lines[i] = l[n:]
+		} else {
+			lines[i] = strings.TrimSpace(l)
+		}
+	}
+	if literal {
+		return strings.Join(lines, "\n")
+	}
+	var buf bytes.Buffer
+	var space bool
+	for _, l := range lines {
+		if l == "" {
+			buf.WriteByte('\n')
+			space = false
+			continue
+		}
+		if space {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(l)
+		space = true
+	}
+	return buf.String()
+}
+
+// parseTOMLFrontMatter parses the subset of TOML found in front matter blocks:
+// top-level keys with basic, literal or multi-line strings, arrays of strings,
+// numbers and booleans.
+func parseTOMLFrontMatter(lines []string) (map[string]string, error) {
+	m := map[string]string{}
+	for i := 0; i < len(lines); i++ {
+		l := strings.TrimSpace(lines[i])
+		if l == "" || l[0] == '#' {
+			continue
+		}
+		if l[0] == '[' {
+			return nil, fmt.Errorf("front matter line %d: tables are not supported", i+1)
+		}
+		kv := strings.SplitN(l, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("front matter line %d: invalid format: %q", i+1, l)
+		}
+		k := frontMatterKey(unquote(strings.TrimSpace(kv[0])))
+		v := strings.TrimSpace(kv[1])
+
+		switch {
+		case strings.HasPrefix(v, `"""`) || strings.HasPrefix(v, "'''"):
+			q := v[:3]
+			s := v[3:]
+			for !strings.HasSuffix(s, q) {
+				i++
+				if i >= len(lines) {
+					return nil, fmt.Errorf("front matter key %q: unterminated string", k)
+				}
+				s += "\n" + strings.TrimRight(lines[i], " \t\r")
+			}
+			m[k] = strings.TrimPrefix(strings.TrimSuffix(s, q), "\n")
+		case strings.HasPrefix(v, "["):
+			for !strings.HasSuffix(v, "]") && i+1 < len(lines) {
+				i++
+				v += " " + strings.TrimSpace(lines[i])
+			}
+			items, err := flowList(v)
+			if err != nil {
+				return nil, fmt.Errorf("front matter line %d: %v", i+1, err)
+			}
+			m[k] = strings.Join(items, ", ")
+		default:
+			m[k] = unquote(v)
+		}
+	}
+	return m, nil
+}
+
+// flowList parses a list of scalars of the form [a, "b", 'c'].
+// Commas within quoted scalars do not separate items.
+func flowList(s string) ([]string, error) {
+	if !strings.HasPrefix(s, "[") || !strings.HasSuffix(s, "]") {
+		return nil, fmt.Errorf("invalid list: %q", s)
+	}
+	var items []string
+	add := func(v string) {
+		if v = unquote(strings.TrimSpace(v)); v != "" {
+			items = append(items, v)
+		}
+	}
+	s = s[1 : len(s)-1]
+	var quote byte // quote of the current scalar, if any
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote == '"' && c == '\\':
+			i++ // escaped character
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ',':
+			add(s[start:i])
+			start = i + 1
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated string in list: %q", "["+s+"]")
+	}
+	add(s[start:])
+	return items, nil
+}
+
+// unquote removes the quotes around a double or single quoted string.
+// Unquoted values are returned as is, without any trailing comment.
+func unquote(s string) string {
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		if v, err := strconv.Unquote(s); err == nil {
+			return v
+		}
+		return s[1 : len(s)-1]
+	}
+	if len(s) >= 2 && s[0] == '\'' && s[len(s)-1] == '\'' {
+		return strings.Replace(s[1:len(s)-1], "''", "'", -1)
+	}
+	if i := strings.Index(s, " #"); i >= 0 {
+		s = strings.TrimSpace(s[:i])
+	}
+	return s
+}
+
+// frontMatterKey normalizes a front matter key.
+// Underscores and dashes are read as spaces only in known metadata keys,
+// other keys are kept as is.
+func frontMatterKey(k string) string {
+	k = strings.ToLower(strings.TrimSpace(k))
+	if n := frontMatterKeyReplacer.Replace(k); frontMatterMetaKeys[n] {
+		return n
+	}
+	return k
+}
+
+// indent returns the number of leading spaces or tabs of l.
+func indent(l string) int {
+	return len(l) - len(strings.TrimLeft(l, " \t"))
+}
+
+// trimLines returns lines with leading and trailing spaces removed from each line.
+func trimLines(lines []string) []string {
+	res := make([]string, len(lines))
+	for i, l := range lines {
+		res[i] = strings.TrimSpace(l)
+	}
+	return res
+}
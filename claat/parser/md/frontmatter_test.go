@@ -0,0 +1,169 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package md
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitFrontMatter(t *testing.T) {
+	tests := []struct {
+		in   string
+		meta map[string]string
+		rest string
+	}{
+		{"# Title\n", nil, "# Title\n"},
+		{
+			"---\n" +
+				"id: my-codelab\n" +
+				"summary: >\n" +
+				"  A summary spanning\n" +
+				"  two lines.\n" +
+				"\n" +
+				"  And a paragraph.\n" +
+				"categories: [Web, \"Cloud\"]\n" +
+				"tags:\n" +
+				"  - web\n" +
+				"  - kiosk\n" +
+				"feedback_link: https://example.com/issues # comment\n" +
+				"notes: |\n" +
+				"  line one\n" +
+				"    line two\n" +
+				"author: 'Jane ''JD'' Doe'\n" +
+				"Lab_Level: 2\n" +
+				"---\n" +
+				"# Title\n",
+			map[string]string{
+				"id":            "my-codelab",
+				"summary":       "A summary spanning two lines.\nAnd a paragraph.",
+				"categories":    "Web, Cloud",
+				"tags":          "web, kiosk",
+				"feedback link": "https://example.com/issues",
+				"notes":         "line one\n  line two",
+				"author":        "Jane 'JD' Doe",
+				"lab_level":     "2",
+			},
+			strings.Repeat("\n", 18) + "# Title\n",
+		},
+		{
+			"+++\n" +
+				"id = \"my-codelab\"\n" +
+				"summary = \"\"\"\n" +
+				"First line.\n" +
+				"Second line.\"\"\"\n" +
+				"categories = [\"web\",\n" +
+				"  \"cloud\"]\n" +
+				"analytics-account = 'UA-123'\n" +
+				"+++\n" +
+				"# Title\n",
+			map[string]string{
+				"id":                "my-codelab",
+				"summary":           "First line.\nSecond line.",
+				"categories":        "web, cloud",
+				"analytics account": "UA-123",
+			},
+			strings.Repeat("\n", 9) + "# Title\n",
+		},
+	}
+	for i, tc := range tests {
+		meta, rest, err := splitFrontMatter([]byte(tc.in))
+		if err != nil {
+			t.Errorf("%d: splitFrontMatter: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(meta, tc.meta) {
+			t.Errorf("%d: meta = %q; want %q", i, meta, tc.meta)
+		}
+		if string(rest) != tc.rest {
+			t.Errorf("%d: rest = %q; want %q", i, rest, tc.rest)
+		}
+	}
+}
+
+func TestSplitFrontMatterError(t *testing.T) {
+	tests := []string{
+		"---\nid: unterminated\n",
+		"---\nid:\n  nested: y\nother: z\n---\n",
+		"---\n  id: x\n---\n",
+		"+++\n[table]\nid = \"x\"\n+++\n",
+		"---\ntags: [\"a, b\n---\n",
+	}
+	for i, tc := range tests {
+		if _, _, err := splitFrontMatter([]byte(tc)); err == nil {
+			t.Errorf("%d: splitFrontMatter(%q) returned no error", i, tc)
+		}
+	}
+}
+
+func TestFlowList(t *testing.T) {
+	tests := []struct {
+		in  string
+		out []string
+	}{
+		{"[]", nil},
+		{"[a, b]", []string{"a", "b"}},
+		{`["a, b", c]`, []string{"a, b", "c"}},
+		{`['it''s, here', "say \"x, y\"", z]`, []string{"it's, here", `say "x, y"`, "z"}},
+	}
+	for _, tc := range tests {
+		out, err := flowList(tc.in)
+		if err != nil {
+			t.Errorf("flowList(%q): %v", tc.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(out, tc.out) {
+			t.Errorf("flowList(%q) = %q; want %q", tc.in, out, tc.out)
+		}
+	}
+	for _, s := range []string{"a, b", `["a, b]`} {
+		if _, err := flowList(s); err == nil {
+			t.Errorf("flowList(%q) returned no error", s)
+		}
+	}
+}
+
+func TestParseFrontMatter(t *testing.T) {
+	const markup = "---\n" +
+		"id: my-codelab\n" +
+		"title: Front matter title\n" +
+		"categories:\n" +
+		"  - Web\n" +
+		"  - Cloud\n" +
+		"---\n" +
+		"\n" +
+		"## First step\n" +
+		"Duration: 0:05\n"
+	c, err := (&Parser{}).Parse(strings.NewReader(markup), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.ID != "my-codelab" {
+		t.Errorf("c.ID = %q; want %q", c.ID, "my-codelab")
+	}
+	if c.Title != "Front matter title" {
+		t.Errorf("c.Title = %q; want %q", c.Title, "Front matter title")
+	}
+	if want := []string{"web", "cloud"}; !reflect.DeepEqual(c.Categories, want) {
+		t.Errorf("c.Categories = %q; want %q", c.Categories, want)
+	}
+	if len(c.Steps) != 1 || c.Steps[0].Title != "First step" {
+		t.Fatalf("c.Steps = %+v; want one step titled %q", c.Steps, "First step")
+	}
+	if c.Duration != 5 {
+		t.Errorf("c.Duration = %d; want 5", c.Duration)
+	}
+}
@@ -22,10 +22,13 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net/url"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
+	"unicode"
 
 	"golang.org/x/net/html"
 	"golang.org/x/net/html/atom"
@@ -45,14 +48,41 @@ const (
 	metaFeedbackLink     = "feedback link"
 	metaAnalyticsAccount = "analytics account"
 	metaTags             = "tags"
+	metaTitle            = "title"
+
+	surveyTerm = "survey" // definition list term starting a survey
+
+	buttonTitle    = "button"   // link title turning a link into a button
+	buttonRaised   = "raised"   // raised button style
+	buttonColored  = "colored"  // colored button style
+	buttonDownload = "download" // button with a download icon
 )
 
+// infoboxKinds maps definition list terms to the kind of infobox they create.
+var infoboxKinds = map[string]types.InfoboxKind{
+	"positive":  types.InfoboxPositive,
+	"tip":       types.InfoboxPositive,
+	"negative":  types.InfoboxNegative,
+	"warning":   types.InfoboxNegative,
+	"note":      types.InfoboxNote,
+	"important": types.InfoboxImportant,
+	"caution":   types.InfoboxCaution,
+}
+
 var metadataRegexp = regexp.MustCompile(`(.+?):(.+)`)
 var languageRegexp = regexp.MustCompile(`language-(.+)`)
-var durationHintRegexp = regexp.MustCompile(`(?i)Duration:? (.+)`)
+var durationHintRegexp = regexp.MustCompile(`(?i)^\s*Duration:?\s+(.+)`)
 var durationRegexp = regexp.MustCompile(`(\d+)[:.](\d{2})$`)
+var environmentHintRegexp = regexp.MustCompile(`^(?i)Environments?:\s*(.+)$`)
 var downloadButtonRegexp = regexp.MustCompile(`^(?i)Download(.+)$`)
 
+// roleSpanRegexp matches text with a semantic role, written as [text]{.role}, e.g. [PROJECT_ID]{.placeholder}.
+var roleSpanRegexp = regexp.MustCompile(`\[([^\[\]]+)\]\{\.(placeholder|ui)\}`)
+
+// roleEndRegexp matches the end of a text span with a semantic role made of several nodes,
+// such as [`PROJECT_ID`]{.placeholder} or [**Save**]{.ui}.
+var roleEndRegexp = regexp.MustCompile(`\]\{\.(placeholder|ui)\}`)
+
 // init registers this parser so it is available to CLaaT.
 func init() {
 	parser.Register("md", &Parser{})
@@ -69,15 +99,40 @@ func (p *Parser) Parse(r io.Reader, parseFragments bool) (*types.Codelab, error)
 	if err != nil {
 		return nil, err
 	}
-	b = claatMarkdown(b)
-	h := bytes.NewBuffer(b)
+	// Front matter is not Markdown, so it has to be taken out first.
+	meta, b, err := splitFrontMatter(b)
+	if err != nil {
+		return nil, err
+	}
+	h := bytes.NewBuffer(claatMarkdown(b))
 	// Parse the markup.
-	return parseMarkup(h)
+	return parseMarkup(h, b, meta, parseFragments)
 }
 
 // ParseFragment parses a codelab fragment writtet in Markdown.
-func (p *Parser) ParseFragment(r io.Reader, parseFragments bool) ([]types.Node, error) {
-	return nil, errors.New("fragment parser not implemented")
+// A fragment has neither metadata nor a codelab title.
+func (p *Parser) ParseFragment(r io.Reader, parseFragments bool) ([]types.Node, []*types.Warning, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	h := bytes.NewBuffer(claatMarkdown(b))
+	return parseFragment(h, b, parseFragments)
+}
+
+// inlineAtoms contains the elements understood by parseInline.
+var inlineAtoms = map[atom.Atom]bool{
+	atom.Em:     true,
+	atom.Strong: true,
+	atom.Code:   true,
+	atom.Img:    true,
+	atom.A:      true,
+	atom.Br:     true,
+	atom.Del:    true,
+	atom.S:      true,
+	atom.U:      true,
+	atom.Sup:    true,
+	atom.Sub:    true,
 }
 
 // parserState encapsulates the state of the parser at any given step.
@@ -86,14 +141,85 @@ type parserState struct {
 	c   *types.Codelab
 	t   html.Token
 
-	currentStep *types.Step
+	currentStep  *types.Step
+	parseImports bool // whether to emit types.ImportNode for [[import]] directives
+	survey       int  // last used survey ID
+
+	// env contains environment tags of the current block-level Environment hint.
+	// They are applied to all nodes emitted after the hint.
+	env []string
+
+	// Track text styling settings.
+	bold, italic                         bool
+	strikethrough, underline, super, sub bool
+
+	// Non-fatal problems found so far.
+	warnings []*types.Warning
+
+	// Markdown source of the markup, used to locate parsed nodes.
+	// Nodes are not located if src is nil.
+	src   []byte
+	off   int // source offset past the last located node
+	block int // source offset at the start of the current top-level block
 }
 
 // emit accepts a node, and either writes the node directly to the current step, or writes the node to the node buffer.
 func (ps *parserState) emit(n types.Node) {
+	if len(ps.env) != 0 {
+		n.MutateEnv(mergeEnv(n.Env(), ps.env))
+	}
+	if !n.Pos().IsValid() {
+		n.MutatePos(ps.locate(nodeText(n), ps.block))
+	}
 	ps.currentStep.Content.Append(n)
 }
 
+// locate returns the source position of the first occurrence of s at or after the source offset from,
+// and moves the source offset past it. Markdown syntax and typography replacements make the markup text
+// differ from its source, so s is trimmed down to its leading run of letters, digits and spaces.
+// If s is not found, the position at from is returned. It returns the zero position if ps.src is nil.
+func (ps *parserState) locate(s string, from int) types.Pos {
+	if ps.src == nil || from > len(ps.src) {
+		return types.Pos{}
+	}
+	i := from
+	if s = searchText(s); s != "" {
+		if j := bytes.Index(ps.src[from:], []byte(s)); j >= 0 {
+			i += j
+			if i+len(s) > ps.off {
+				ps.off = i + len(s)
+			}
+		}
+	}
+	bol := bytes.LastIndexByte(ps.src[:i], '\n') + 1
+	return types.Pos{
+		Line: bytes.Count(ps.src[:i], []byte("\n")) + 1,
+		Col:  i - bol + 1,
+	}
+}
+
+// warn records a non-fatal problem found at source position pos.
+func (ps *parserState) warn(sev types.Severity, pos types.Pos, format string, args ...interface{}) {
+	ps.warnings = append(ps.warnings, &types.Warning{
+		Severity: sev,
+		Pos:      pos,
+		Msg:      fmt.Sprintf(format, args...),
+	})
+}
+
+// locateTag returns the source position of the first raw HTML start tag of element name
+// at or after the source offset. Elements generated from Markdown syntax, such as <hr>,
+// have no such tag, in which case the position at the source offset is returned.
+func (ps *parserState) locateTag(name string) types.Pos {
+	from := ps.off
+	if ps.src != nil && from <= len(ps.src) {
+		if i := bytes.Index(ps.src[from:], []byte("<"+name)); i >= 0 {
+			from += i
+		}
+	}
+	return ps.locate("", from)
+}
+
 // advance moves the tokenizer to the next token and updates the token convenience variable.
 func (ps *parserState) advance() {
 	ps.tzr.Next()
@@ -119,7 +245,8 @@ func claatMarkdown(b []byte) []byte {
 		blackfriday.EXTENSION_NO_EMPTY_LINE_BEFORE_BLOCK |
 		blackfriday.EXTENSION_NO_INTRA_EMPHASIS |
 		blackfriday.EXTENSION_DEFINITION_LISTS |
-		blackfriday.EXTENSION_TABLES
+		blackfriday.EXTENSION_TABLES |
+		blackfriday.EXTENSION_STRIKETHROUGH
 	o := blackfriday.Options{
 		Extensions: extns,
 	}
@@ -128,11 +255,19 @@ func claatMarkdown(b []byte) []byte {
 }
 
 // parseMarkup accepts an io.Reader to markup created by the Devsite Markdown parser. It returns a pointer to a codelab object, or an error if one occurs.
-func parseMarkup(markup io.Reader) (*types.Codelab, error) {
+// The src argument is the Markdown source of the markup, used to locate steps and nodes, and may be nil.
+// The meta argument holds metadata found in the front matter of the document, if any. A title set in the front matter
+// replaces the title header of the document.
+func parseMarkup(markup io.Reader, src []byte, meta map[string]string, parseImports bool) (*types.Codelab, error) {
 	// Avoid global vars by encapsulating state.
 	ps := parserState{
-		tzr: html.NewTokenizer(markup),
-		c:   &types.Codelab{},
+		tzr:          html.NewTokenizer(markup),
+		c:            &types.Codelab{},
+		parseImports: parseImports,
+		src:          src,
+	}
+	if meta != nil {
+		addMetadataToCodelab(meta, ps.c)
 	}
 
 	var inStepTitle bool
@@ -162,6 +297,8 @@ func parseMarkup(markup io.Reader) (*types.Codelab, error) {
 			ps.advance()
 			// Emit a step object.
 			ps.currentStep = ps.c.NewStep(stepTitle)
+			ps.currentStep.Pos = ps.locate(stepTitle, ps.off)
+			ps.env = nil
 			parseStep(&ps)
 
 			// If we just finished parsing a step or the title, we are left possibly pointing to the opening
@@ -180,9 +317,37 @@ func parseMarkup(markup io.Reader) (*types.Codelab, error) {
 	}
 
 	finalizeCodelab(&ps)
+	ps.c.Warnings = ps.warnings
 	return ps.c, nil
 }
 
+// parseFragment is similar to parseMarkup except it expects neither metadata nor a codelab title.
+// All of the markup is parsed as the content of a single step, whose nodes are returned.
+// Non-fatal problems are returned as warnings, including any codelab or step title,
+// which is dropped since a fragment cannot start steps of its own.
+func parseFragment(markup io.Reader, src []byte, parseImports bool) ([]types.Node, []*types.Warning, error) {
+	ps := parserState{
+		tzr:          html.NewTokenizer(markup),
+		c:            &types.Codelab{},
+		parseImports: parseImports,
+		src:          src,
+	}
+	ps.currentStep = ps.c.NewStep("fragment")
+	for ps.advance(); ps.t.Type != html.ErrorToken; ps.advance() {
+		if ps.t.Type == html.StartTagToken && (ps.t.DataAtom == atom.H1 || ps.t.DataAtom == atom.H2) {
+			a := ps.t.DataAtom
+			title := strings.TrimSpace(collectText(&ps, a))
+			ps.warn(types.SeverityWarning, ps.locate(title, ps.off), "title %q ignored: fragments cannot start steps, use ### headers instead", title)
+			continue
+		}
+		parseNode(&ps)
+	}
+	if err := ps.tzr.Err(); err != io.EOF {
+		return nil, nil, err
+	}
+	return ps.currentStep.Content.Nodes, ps.warnings, nil
+}
+
 // parseMetadata handles the metadata section preceding a codelab.
 // It assumes the tokenizer is pointing to the first <p>/.
 // It returns any errors it encounters, and leaves the tokenizer pointing at the <h1>
@@ -197,7 +362,10 @@ func parseMetadata(ps *parserState) error {
 			// Split the keys from values.
 			s := metadataRegexp.FindStringSubmatch(ps.t.Data)
 			if len(s) != 3 {
-				return fmt.Errorf("invalid metadata format: %v", s)
+				if pos := ps.locate(ps.t.Data, ps.off); pos.IsValid() {
+					return fmt.Errorf("%v: invalid metadata format: %q", pos, ps.t.Data)
+				}
+				return fmt.Errorf("invalid metadata format: %q", ps.t.Data)
 			}
 			k := strings.ToLower(strings.TrimSpace(s[1]))
 			v := strings.TrimSpace(s[2])
@@ -217,63 +385,348 @@ func parseStep(ps *parserState) error {
 	if ps.t.Type == html.TextToken {
 		ps.advance()
 	}
-	if ps.t.Type == html.StartTagToken && ps.t.DataAtom == atom.P {
-		if err := handleDurationHint(ps); err != nil {
-			return err
+	// Any number of duration and environment hints may follow the title.
+	for ps.t.Type == html.StartTagToken && ps.t.DataAtom == atom.P {
+		if !handleStepHint(ps) {
+			break
+		}
+		ps.advance()
+		if ps.t.Type == html.TextToken && strings.TrimSpace(ps.t.Data) == "" {
+			ps.advance()
 		}
 	}
 
-	// Track text styling settings.
-	var bold, italic bool
-
 	// Continue reading tokens in order, stopping on an error or the beginning of another step.
 	for ; ps.t.Type != html.ErrorToken && !(ps.t.Type == html.StartTagToken && ps.t.DataAtom == atom.H2); ps.advance() {
+		parseNode(ps)
+	}
+	return nil
+}
+
+// parseNode handles the block element or inline content the tokenizer is pointing to, emitting the resulting nodes.
+// It leaves the tokenizer pointing at the last token it consumed.
+func parseNode(ps *parserState) {
+	ps.block = ps.off
+	// Handle <h3> through <h6>.
+	if ps.t.Type == html.StartTagToken && (ps.t.DataAtom == atom.H3 || ps.t.DataAtom == atom.H4 || ps.t.DataAtom == atom.H5 || ps.t.DataAtom == atom.H6) {
+		// Headers end the scope of an environment hint.
+		ps.env = nil
+		handleHeader(ps)
+		return
+	}
+	// Handle <p>.
+	if ps.t.Type == html.StartTagToken && ps.t.DataAtom == atom.P {
+		n := handleParagraph(ps)
+		if n == nil {
+			return
+		}
+		if env := environmentHint(n); env != nil {
+			handleEnvironmentHint(ps, env)
+			return
+		}
+		ps.emit(n)
+		return
+	}
+	// Handle <pre>.
+	if ps.t.Type == html.StartTagToken && ps.t.DataAtom == atom.Pre {
+		ps.emit(handleFencedCodeBlock(ps))
+		return
+	}
+	// Handle <ul> and <ol>.
+	if ps.t.Type == html.StartTagToken && (ps.t.DataAtom == atom.Ul || ps.t.DataAtom == atom.Ol) {
+		if n := handleList(ps); n != nil {
+			ps.emit(n)
+		}
+		return
+	}
+	// Handle <table>.
+	if ps.t.Type == html.StartTagToken && ps.t.DataAtom == atom.Table {
+		if n := handleTable(ps); n != nil {
+			ps.emit(n)
+		}
+		return
+	}
+	// Handle <dl>.
+	if ps.t.Type == html.StartTagToken && ps.t.DataAtom == atom.Dl {
+		handleDefinitionList(ps)
+		return
+	}
+	// Blank lines between blocks carry no content.
+	if ps.t.Type == html.TextToken && strings.TrimSpace(ps.t.Data) == "" {
+		return
+	}
+	// Anything else is inline content outside of a paragraph.
+	if n := parseInline(ps); n != nil {
+		ps.emit(n)
+	}
+}
 
-		// Handle <h3> through <h6>.
-		if ps.t.Type == html.StartTagToken && (ps.t.DataAtom == atom.H3 || ps.t.DataAtom == atom.H4 || ps.t.DataAtom == atom.H5 || ps.t.DataAtom == atom.H6) {
-			handleHeader(ps)
+// parseInline handles a single inline token: text, <em>, <strong>, <code>, <img> or <a>.
+// It returns the resulting node, or nil if the token produces no content by itself.
+// Elements it does not understand are reported as warnings; their content is parsed as usual.
+func parseInline(ps *parserState) types.Node {
+	n := parseInlineToken(ps)
+	if n != nil {
+		if !n.Pos().IsValid() {
+			n.MutatePos(ps.locate(nodeText(n), ps.off))
 		}
-		// Handle <pre>.
-		if ps.t.Type == html.StartTagToken && ps.t.DataAtom == atom.Pre {
-			handleFencedCodeBlock(ps)
+		return n
+	}
+	if (ps.t.Type == html.StartTagToken || ps.t.Type == html.SelfClosingTagToken) && !inlineAtoms[ps.t.DataAtom] {
+		ps.warn(types.SeverityWarning, ps.locateTag(ps.t.Data), "unsupported element <%s>", ps.t.Data)
+	}
+	return nil
+}
+
+// parseInlineToken does the actual work of parseInline.
+func parseInlineToken(ps *parserState) types.Node {
+	switch {
+	// Handle <em>.
+	case ps.t.DataAtom == atom.Em:
+		ps.italic = ps.t.Type == html.StartTagToken
+	// Hande <strong>.
+	case ps.t.DataAtom == atom.Strong:
+		ps.bold = ps.t.Type == html.StartTagToken
+	// Handle <del>, written as ~~text~~, and <s>.
+	case ps.t.DataAtom == atom.Del || ps.t.DataAtom == atom.S:
+		ps.strikethrough = ps.t.Type == html.StartTagToken
+	// Handle <u>, <sup> and <sub>, which are only available as HTML.
+	case ps.t.DataAtom == atom.U:
+		ps.underline = ps.t.Type == html.StartTagToken
+	case ps.t.DataAtom == atom.Sup:
+		ps.super = ps.t.Type == html.StartTagToken
+	case ps.t.DataAtom == atom.Sub:
+		ps.sub = ps.t.Type == html.StartTagToken
+	// Handle <code>.
+	case ps.t.DataAtom == atom.Code && ps.t.Type == html.StartTagToken:
+		return handleInlineCodeBlock(ps)
+	// Handle <img>.
+	case ps.t.DataAtom == atom.Img:
+		return handleImage(ps)
+	// Handle <a>.
+	case ps.t.DataAtom == atom.A && ps.t.Type == html.StartTagToken:
+		return handleLink(ps)
+	// Handle <br>.
+	case ps.t.DataAtom == atom.Br:
+		return types.NewTextNode("\n")
+	// Handle text.
+	case ps.t.Type == html.TextToken:
+		n := newBreaklessTextNode(ps.t.Data)
+		n.Bold = ps.bold
+		n.Italic = ps.italic
+		n.Strikethrough = ps.strikethrough
+		n.Underline = ps.underline
+		n.Superscript = ps.super
+		n.Subscript = ps.sub
+		return n
+	}
+	return nil
+}
+
+// parseInlineUntil handles all inline tokens up to the end tag of a, which is where it leaves the tokenizer.
+// It assumes the tokenizer is pointing to the start tag of a. It returns the resulting nodes.
+func parseInlineUntil(ps *parserState, a atom.Atom) []types.Node {
+	var nodes []types.Node
+	for ps.advance(); ps.t.Type != html.ErrorToken && !(ps.t.Type == html.EndTagToken && ps.t.DataAtom == a); ps.advance() {
+		if n := parseInline(ps); n != nil {
+			nodes = append(nodes, n)
 		}
-		// Handle <code>.
-		if ps.t.Type == html.StartTagToken && ps.t.DataAtom == atom.Code {
-			handleInlineCodeBlock(ps)
+	}
+	nodes = splitRoleSpans(nodes)
+	markInlineImages(nodes)
+	return nodes
+}
+
+// splitRoleSpans splits the text nodes among nodes at spans of text with a semantic role,
+// written as [text]{.role}. It returns the resulting nodes. Inline code is left as is.
+func splitRoleSpans(nodes []types.Node) []types.Node {
+	var res []types.Node
+	for _, n := range nodes {
+		t, ok := n.(*types.TextNode)
+		if !ok || t.Code {
+			res = append(res, n)
+			continue
 		}
-		// Handle <ul> and <ol>.
-		if ps.t.Type == html.StartTagToken && (ps.t.DataAtom == atom.Ul || ps.t.DataAtom == atom.Ol) {
-			handleList(ps)
+		v := t.Value
+		spans := roleSpanRegexp.FindAllStringSubmatchIndex(v, -1)
+		if len(spans) == 0 {
+			res = append(res, t)
+			continue
 		}
-		// Handle <dt>.
-		if ps.t.Type == html.StartTagToken && ps.t.DataAtom == atom.Dt {
-			handleInfobox(ps)
+		var last int
+		for _, m := range spans {
+			if m[0] > last {
+				res = append(res, withText(t, v[last:m[0]], t.Role))
+			}
+			res = append(res, withText(t, v[m[2]:m[3]], types.TextRole(v[m[4]:m[5]])))
+			last = m[1]
 		}
-		// Handle <em>.
-		if ps.t.DataAtom == atom.Em {
-			italic = ps.t.Type == html.StartTagToken
+		if last < len(v) {
+			res = append(res, withText(t, v[last:], t.Role))
 		}
-		// Hande <strong>.
-		if ps.t.DataAtom == atom.Strong {
-			bold = ps.t.Type == html.StartTagToken
+	}
+	return joinRoleSpans(res)
+}
+
+// joinRoleSpans finds text spans with a semantic role spread over several text nodes,
+// such as inline code or bold text in brackets, and sets the role of the nodes in brackets.
+// The brackets and the role are removed from the text.
+func joinRoleSpans(nodes []types.Node) []types.Node {
+	for i := 0; i < len(nodes); i++ {
+		end, ok := nodes[i].(*types.TextNode)
+		if !ok || end.Code || end.Role != "" {
+			continue
 		}
-		// Handle <img>.
-		if ps.t.DataAtom == atom.Img {
-			handleImage(ps)
+		m := roleEndRegexp.FindStringSubmatchIndex(end.Value)
+		if m == nil || strings.ContainsAny(end.Value[:m[0]], "[]") {
+			continue
 		}
-		// Handle <a>.
-		if ps.t.DataAtom == atom.A && ps.t.Type == html.StartTagToken {
-			handleLink(ps)
+		j, k := roleSpanStart(nodes[:i])
+		if j < 0 {
+			continue
 		}
-		// Handle text.
-		if ps.t.Type == html.TextToken {
-			n := newBreaklessTextNode(ps.t.Data)
-			n.Bold = bold
-			n.Italic = italic
-			ps.emit(n)
+		role := types.TextRole(end.Value[m[2]:m[3]])
+		start := nodes[j].(*types.TextNode)
+
+		res := append([]types.Node{}, nodes[:j]...)
+		if v := start.Value[:k]; v != "" {
+			res = append(res, withText(start, v, ""))
+		}
+		if v := start.Value[k+1:]; v != "" {
+			res = append(res, withText(start, v, role))
+		}
+		for _, n := range nodes[j+1 : i] {
+			t := n.(*types.TextNode)
+			res = append(res, withText(t, t.Value, role))
+		}
+		if v := end.Value[:m[0]]; v != "" {
+			res = append(res, withText(end, v, role))
+		}
+		next := len(res)
+		if v := end.Value[m[1]:]; v != "" {
+			res = append(res, withText(end, v, ""))
+		}
+		nodes = append(res, nodes[i+1:]...)
+		i = next - 1
+	}
+	return nodes
+}
+
+// roleSpanStart finds the opening bracket of a text span with a semantic role,
+// which nodes precede. It returns the index of the text node containing the bracket
+// and the bracket offset in the node text, or -1 if nodes end with anything other
+// than text without a role.
+func roleSpanStart(nodes []types.Node) (int, int) {
+	for j := len(nodes) - 1; j >= 0; j-- {
+		t, ok := nodes[j].(*types.TextNode)
+		if !ok || t.Role != "" {
+			break
+		}
+		if t.Code {
+			continue
+		}
+		if k := strings.LastIndexAny(t.Value, "[]"); k >= 0 {
+			if t.Value[k] == ']' {
+				break
+			}
+			return j, k
+		}
+	}
+	return -1, -1
+}
+
+// withText returns a copy of text node t with value v and role r.
+func withText(t *types.TextNode, v string, r types.TextRole) *types.TextNode {
+	c := *t
+	c.Value = v
+	c.Role = r
+	return &c
+}
+
+// markInlineImages marks the images among nodes, the content of a paragraph or a list item,
+// as inline when they are part of a line of text, such as icons in an instruction.
+// An image followed by its caption stands alone.
+func markInlineImages(nodes []types.Node) {
+	if img, _ := parser.ImageCaption(nodes); img != nil {
+		return
+	}
+	var text bool
+	for _, n := range nodes {
+		if n.Type() != types.NodeImage && !n.Empty() {
+			text = true
+			break
+		}
+	}
+	if !text {
+		return
+	}
+	for _, n := range nodes {
+		if img, ok := n.(*types.ImageNode); ok {
+			img.Inline = true
 		}
 	}
-	return nil
+}
+
+// handleParagraph handles a <p> element. It assumes the tokenizer is pointing to <p>, and leaves it pointing to </p>.
+// It returns a block list node containing the paragraph content, a node resulting from a [[directive]],
+// or nil if the paragraph is empty.
+func handleParagraph(ps *parserState) types.Node {
+	nodes := parseInlineUntil(ps, atom.P)
+	if types.EmptyNodes(nodes) {
+		return nil
+	}
+	if n := handleDirective(ps, nodes); n != nil {
+		return n
+	}
+	// An image pointing to a YouTube video is embedded if it is alone in its paragraph.
+	if len(nodes) == 1 {
+		if img, ok := nodes[0].(*types.ImageNode); ok {
+			if id := youtubeID(img.Src); id != "" {
+				n := types.NewYouTubeNode(id)
+				n.MutateBlock(true)
+				n.MutatePos(img.Pos())
+				return n
+			}
+		}
+	}
+	nodes = videoLinks(nodes)
+	// An image followed by a line in italics is a captioned image.
+	if img, caption := parser.ImageCaption(nodes); img != nil {
+		img.Caption = caption
+		nodes = nodes[:1]
+	}
+	n := types.NewListNode(nodes...)
+	n.MutateBlock(true)
+	return n
+}
+
+// handleDirective checks whether nodes form a [[directive ...]] paragraph, the same construction
+// recognized by the gdoc parser, e.g. "[[**import** [shared](https://example.com/shared.md)]]".
+// The directive is executed using the directive registered with parser.RegisterDirective.
+// It returns the result of the directive, or nil if nodes is not a known directive.
+// Unknown and malformed directives are reported as warnings.
+func handleDirective(ps *parserState, nodes []types.Node) types.Node {
+	d := parser.ParseDirective(nodes)
+	if d == nil {
+		return nil
+	}
+	// the directive is located at its name
+	pos := nodes[1].Pos()
+	fn, ok := parser.LookupDirective(d.Name)
+	if !ok {
+		ps.warn(types.SeverityWarning, pos, "unknown directive [[%s]]", d.Name)
+		return nil
+	}
+	d.ParseImports = ps.parseImports
+	n, err := fn(d)
+	if err != nil {
+		ps.warn(types.SeverityError, pos, "[[%s]]: %v", d.Name, err)
+		return nil
+	}
+	if n != nil {
+		n.MutatePos(pos)
+	}
+	return n
 }
 
 // handleCodelabTitle takes care of setting the title for the codelab. It assumes the tokenizer is pointing to <h1>.
@@ -304,26 +757,108 @@ func processDuration(d string) (time.Duration, error) {
 	return 0, errors.New("unrecognized duration string")
 }
 
-// handleDurationHint parses the optional duration string at the beginning of a codelab step. It assumes the tokenizer is
-// pointing at the inital <p> of the step. It returns any errors it encounters in the process.
-func handleDurationHint(ps *parserState) error {
-	ps.advance()
-	// If this isn't text, this also isnt a duration string.
-	if ps.t.Type != html.TextToken {
-		return nil
+// handleStepHint parses an optional duration or environment hint at the beginning of a codelab step.
+// It assumes the tokenizer is pointing at a <p> of the step, and leaves it pointing at the closing </p>.
+// An environment hint applies to the whole step. If the paragraph turns out to be neither,
+// it is emitted as regular step content. It reports whether the paragraph was a hint.
+// A duration hint which cannot be parsed is reported as a warning.
+func handleStepHint(ps *parserState) bool {
+	n := handleParagraph(ps)
+	if n == nil {
+		return false
+	}
+	if env := environmentHint(n); env != nil {
+		ps.currentStep.Tags = mergeEnv(ps.currentStep.Tags, env)
+		ps.c.Tags = appendMissing(ps.c.Tags, env)
+		return true
 	}
-	s := durationHintRegexp.FindStringSubmatch(ps.t.Data)
 	// This is possibly not a duration string, so bail out if we don't have strong indications that it is.
-	var err error
-	if len(s) >= 2 {
-		ps.currentStep.Duration, err = processDuration(s[1])
-		if err != nil {
-			return err
+	s := durationHintRegexp.FindStringSubmatch(hintText(n))
+	if len(s) < 2 {
+		ps.emit(n)
+		return false
+	}
+	d, err := processDuration(s[1])
+	if err != nil {
+		// hintText only matches paragraphs made of a single text node
+		pos := n.(*types.ListNode).Nodes[0].Pos()
+		ps.warn(types.SeverityWarning, pos, "invalid step duration %q: %v", s[1], err)
+		// most likely regular content starting with the word
+		ps.emit(n)
+		return false
+	}
+	ps.currentStep.Duration = d
+	return true
+}
+
+// handleEnvironmentHint handles an environment hint found in the middle of a step.
+// All nodes emitted after the hint, up to the next header or hint, are restricted to env.
+// A hint following a header applies to the header as well. The special "all" environment
+// lifts the restriction.
+func handleEnvironmentHint(ps *parserState, env []string) {
+	if len(env) == 1 && env[0] == "all" {
+		ps.env = nil
+		return
+	}
+	ps.env = env
+	ps.c.Tags = appendMissing(ps.c.Tags, env)
+	if nodes := ps.currentStep.Content.Nodes; len(nodes) > 0 && types.IsHeader(nodes[len(nodes)-1].Type()) {
+		nodes[len(nodes)-1].MutateEnv(env)
+	}
+}
+
+// hintText returns the text of a paragraph n, if it consists of a single text node.
+// It returns an empty string otherwise.
+func hintText(n types.Node) string {
+	l, ok := n.(*types.ListNode)
+	if !ok || len(l.Nodes) != 1 {
+		return ""
+	}
+	t, ok := l.Nodes[0].(*types.TextNode)
+	if !ok {
+		return ""
+	}
+	return strings.TrimSpace(t.Value)
+}
+
+// environmentHint returns the sorted environment tags of a paragraph n of the form "Environment: web, kiosk".
+// It returns nil if n is not an environment hint.
+func environmentHint(n types.Node) []string {
+	s := environmentHintRegexp.FindStringSubmatch(hintText(n))
+	if len(s) != 2 {
+		return nil
+	}
+	return mergeEnv(nil, standardSplit(s[1]))
+}
+
+// mergeEnv returns the sorted union of environment tags a and b, without empty tags.
+// Renderers rely on the tags being sorted.
+func mergeEnv(a, b []string) []string {
+	var env []string
+	for _, v := range appendMissing(append([]string(nil), a...), b) {
+		if v != "" {
+			env = append(env, v)
 		}
 	}
-	ps.advance()
-	// Now we're on the closing p tag of the duration string.
-	return nil
+	sort.Strings(env)
+	return env
+}
+
+// appendMissing appends the elements of b which are not already in a.
+func appendMissing(a, b []string) []string {
+	for _, v := range b {
+		found := false
+		for _, w := range a {
+			if v == w {
+				found = true
+				break
+			}
+		}
+		if !found {
+			a = append(a, v)
+		}
+	}
+	return a
 }
 
 // finalizeCodelab takes care of all work that should be performed after the entire input is parsed.
@@ -364,83 +899,397 @@ func handleHeader(ps *parserState) {
 	ps.advance() // Now we are on the closing tag.
 }
 
-// handleList handles both ordered and unordered lists. It assumes the tokenizer is pointing to <ul> or <ol>.
-// It takes a pointer to a parserState object.
-func handleList(ps *parserState) {
+// handleList handles both ordered and unordered lists. It assumes the tokenizer is pointing to <ul> or <ol>,
+// and leaves it pointing to the matching closing tag. It returns the list, or nil if the list has no items.
+func handleList(ps *parserState) types.Node {
+	a := ps.t.DataAtom
 	start := 0
-	if ps.t.DataAtom == atom.Ol {
+	if a == atom.Ol {
 		start = 1
 	}
 	iln := types.NewItemsListNode("", start)
 
-	for ps.advance(); ps.t.Type != html.ErrorToken && !(ps.t.Type == html.EndTagToken && (ps.t.DataAtom == atom.Ul || ps.t.DataAtom == atom.Ol)); ps.advance() {
+	for ps.advance(); ps.t.Type != html.ErrorToken && !(ps.t.Type == html.EndTagToken && ps.t.DataAtom == a); ps.advance() {
 		if ps.t.Type == html.StartTagToken && ps.t.DataAtom == atom.Li {
-			ps.advance()
-			iln.NewItem(newBreaklessTextNode(ps.t.Data))
+			if nodes := handleListItem(ps); len(nodes) > 0 {
+				iln.NewItem(nodes...)
+			}
+		}
+	}
+	if len(iln.Items) == 0 {
+		return nil
+	}
+	return iln
+}
+
+// handleListItem handles the content of a single list item. It assumes the tokenizer is pointing to <li>,
+// and leaves it pointing to </li>. Item content may be inline, or, in case of loose lists, paragraphs.
+// Nested lists and code blocks are kept as part of the item. It returns the item content nodes.
+// The first paragraph of a loose item is the item text, so it is not a block of its own.
+func handleListItem(ps *parserState) []types.Node {
+	nodes := parseContentUntil(ps, atom.Li)
+	if len(nodes) > 0 && nodes[0].Type() == types.NodeList {
+		nodes[0].MutateBlock(false)
+	}
+	return nodes
+}
+
+// parseContentUntil handles inline content and nested blocks up to the end tag of a, which is where it leaves
+// the tokenizer. It assumes the tokenizer is pointing to the start tag of a. It returns the resulting nodes.
+func parseContentUntil(ps *parserState, a atom.Atom) []types.Node {
+	var nodes []types.Node
+	for ps.advance(); ps.t.Type != html.ErrorToken && !(ps.t.Type == html.EndTagToken && ps.t.DataAtom == a); ps.advance() {
+		var n types.Node
+		switch {
+		case ps.t.Type == html.StartTagToken && (ps.t.DataAtom == atom.Ul || ps.t.DataAtom == atom.Ol):
+			n = handleList(ps)
+		case ps.t.Type == html.StartTagToken && ps.t.DataAtom == atom.P:
+			n = handleParagraph(ps)
+		case ps.t.Type == html.StartTagToken && ps.t.DataAtom == atom.Pre:
+			n = handleFencedCodeBlock(ps)
+		case ps.t.Type == html.StartTagToken && ps.t.DataAtom == atom.Table:
+			n = handleTable(ps)
+		case ps.t.Type == html.TextToken && strings.TrimSpace(ps.t.Data) == "":
+			// Whitespace only matters between inline nodes.
+			if len(nodes) > 0 && types.IsInline(nodes[len(nodes)-1].Type()) {
+				n = parseInline(ps)
+			}
+		default:
+			n = parseInline(ps)
 		}
+		if n == nil {
+			continue
+		}
+		if !types.IsInline(n.Type()) {
+			nodes = trimTrailingSpace(nodes)
+		}
+		nodes = append(nodes, n)
 	}
-	ps.emit(iln)
+	return videoLinks(splitRoleSpans(trimTrailingSpace(nodes)))
 }
 
-// handleInfobox handles the colored call-out boxes in codelabs. It assumes the tokenizer is pointing to <dt>.
-func handleInfobox(ps *parserState) {
-	// Advance to <dt>'s text content.
-	ps.advance()
-	// Deduce the kind of infobox.
-	var kind types.InfoboxKind
-	sentiment := strings.ToLower(ps.t.Data)
-	if sentiment == "positive" {
-		kind = types.InfoboxPositive
-	} else if sentiment == "negative" {
-		kind = types.InfoboxNegative
-	}
-
-	// Advance to <dd>'s text content.
-	ps.multiAdvance(4)
-	n := types.NewInfoboxNode(kind, newBreaklessTextNode(ps.t.Data))
-	ps.emit(n)
+// trimTrailingSpace drops whitespace-only text nodes from the end of nodes,
+// such as line breaks left before a closing tag or a nested block.
+func trimTrailingSpace(nodes []types.Node) []types.Node {
+	for len(nodes) > 0 && nodes[len(nodes)-1].Type() == types.NodeText && nodes[len(nodes)-1].Empty() {
+		nodes = nodes[:len(nodes)-1]
+	}
+	return nodes
+}
 
-	// Advance to </dd>.
-	ps.advance()
+// handleTable handles tables, including their header rows. It assumes the tokenizer is pointing to <table>,
+// and leaves it pointing to </table>. It returns a grid node, or nil if the table has no rows.
+func handleTable(ps *parserState) types.Node {
+	var rows [][]*types.GridCell
+	for ps.advance(); ps.t.Type != html.ErrorToken && !(ps.t.Type == html.EndTagToken && ps.t.DataAtom == atom.Table); ps.advance() {
+		if ps.t.Type != html.StartTagToken {
+			continue
+		}
+		switch ps.t.DataAtom {
+		case atom.Tr:
+			rows = append(rows, nil)
+		case atom.Th, atom.Td:
+			if len(rows) == 0 {
+				rows = append(rows, nil)
+			}
+			cell := &types.GridCell{
+				Colspan: 1,
+				Rowspan: 1,
+				Header:  ps.t.DataAtom == atom.Th,
+			}
+			nodes := videoLinks(trimTrailingSpace(parseInlineUntil(ps, ps.t.DataAtom)))
+			cell.Content = types.NewListNode(nodes...)
+			rows[len(rows)-1] = append(rows[len(rows)-1], cell)
+		}
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	return types.NewGridNode(rows...)
+}
+
+// handleDefinitionList handles definition lists, which are used for infoboxes and surveys.
+// It assumes the tokenizer is pointing to <dl>, and leaves it pointing to </dl>.
+// The term of each definition selects what its descriptions turn into.
+func handleDefinitionList(ps *parserState) {
+	var (
+		term []types.Node
+		kind string
+		sn   *types.SurveyNode
+	)
+	// flushSurvey emits the survey being collected, if any.
+	// Surveys of a codelab without an ID, such as a fragment, are numbered with a generic prefix.
+	flushSurvey := func() {
+		if sn != nil && !sn.Empty() {
+			ps.survey++
+			prefix := ps.c.ID
+			if prefix == "" {
+				prefix = surveyTerm
+			}
+			sn.ID = fmt.Sprintf("%s-%d", prefix, ps.survey)
+			ps.emit(sn)
+		}
+		sn = nil
+	}
+	for ps.advance(); ps.t.Type != html.ErrorToken && !(ps.t.Type == html.EndTagToken && ps.t.DataAtom == atom.Dl); ps.advance() {
+		if ps.t.Type != html.StartTagToken {
+			continue
+		}
+		switch ps.t.DataAtom {
+		case atom.Dt:
+			flushSurvey()
+			term = trimTrailingSpace(parseInlineUntil(ps, atom.Dt))
+			kind = strings.ToLower(hintText(types.NewListNode(term...)))
+			if kind == surveyTerm {
+				sn = types.NewSurveyNode("")
+			}
+		case atom.Dd:
+			if sn != nil {
+				if g := handleSurveyGroup(ps); g != nil {
+					sn.Groups = append(sn.Groups, g)
+				}
+				continue
+			}
+			handleInfobox(ps, kind, term)
+		}
+	}
+	flushSurvey()
+}
+
+// handleSurveyGroup handles a single survey question: the question text followed by a list of options.
+// It assumes the tokenizer is pointing to <dd>, and leaves it pointing to </dd>.
+// It returns nil if the question has no options.
+func handleSurveyGroup(ps *parserState) *types.SurveyGroup {
+	var name string
+	var opts []string
+	for ps.advance(); ps.t.Type != html.ErrorToken && !(ps.t.Type == html.EndTagToken && ps.t.DataAtom == atom.Dd); ps.advance() {
+		switch {
+		case ps.t.Type == html.StartTagToken && ps.t.DataAtom == atom.Li:
+			if o := strings.TrimSpace(collectText(ps, atom.Li)); o != "" {
+				opts = append(opts, o)
+			}
+		case ps.t.Type == html.TextToken:
+			name += ps.t.Data
+		}
+	}
+	if len(opts) == 0 {
+		return nil
+	}
+	return &types.SurveyGroup{
+		Name:    strings.TrimSpace(strings.Join(strings.Fields(name), " ")),
+		Options: opts,
+	}
+}
+
+// collectText concatenates the text of all tokens up to the end tag of a, which is where it leaves the tokenizer.
+// It assumes the tokenizer is pointing to the start tag of a. Line breaks are replaced with spaces.
+func collectText(ps *parserState, a atom.Atom) string {
+	var s string
+	for ps.advance(); ps.t.Type != html.ErrorToken && !(ps.t.Type == html.EndTagToken && ps.t.DataAtom == a); ps.advance() {
+		if ps.t.Type == html.TextToken {
+			s += ps.t.Data
+		}
+	}
+	return strings.Replace(s, "\n", " ", -1)
+}
+
+// handleInfobox handles the colored call-out boxes in codelabs. It assumes the tokenizer is pointing to <dd>,
+// and leaves it pointing to </dd>. The whole description becomes the infobox content, and the kind of infobox
+// is deduced from the definition term. Descriptions of unknown terms are emitted as regular content,
+// preceded by the term in bold.
+func handleInfobox(ps *parserState, kind string, term []types.Node) {
+	nodes := parseContentUntil(ps, atom.Dd)
+	if types.EmptyNodes(nodes) {
+		return
+	}
+	if k, ok := infoboxKinds[kind]; ok {
+		ps.emit(types.NewInfoboxNode(k, nodes...))
+		return
+	}
+	var dt []types.Node
+	for _, n := range term {
+		if t, ok := n.(*types.TextNode); ok {
+			b := *t
+			b.Bold = true
+			n = &b
+		}
+		dt = append(dt, n)
+	}
+	if !types.EmptyNodes(dt) {
+		p := types.NewListNode(dt...)
+		p.MutateBlock(true)
+		ps.emit(p)
+	}
+	if types.IsInline(nodes[0].Type()) {
+		p := types.NewListNode(nodes...)
+		p.MutateBlock(true)
+		ps.emit(p)
+		return
+	}
+	for _, n := range nodes {
+		ps.emit(n)
+	}
 }
 
 // handleImage handles <img> tags. It assumes the tokenizer is pointing to the <img> tag itself.
-func handleImage(ps *parserState) {
+// It returns nil if the image has no src.
+func handleImage(ps *parserState) types.Node {
+	var src, alt, title, width, height, align string
 	for _, v := range ps.t.Attr {
-		if v.Key == "src" {
-			ps.emit(types.NewImageNode(v.Val))
-			break
+		switch v.Key {
+		case "src":
+			src = v.Val
+		case "alt":
+			alt = v.Val
+		case "title":
+			title = v.Val
+		case "width":
+			width = v.Val
+		case "height":
+			height = v.Val
+		case "align":
+			align = v.Val
 		}
 	}
+	if src == "" {
+		ps.warn(types.SeverityWarning, ps.locate(alt, ps.off), "image %q without source ignored", alt)
+		return nil
+	}
+	n := types.NewImageNode(src)
+	n.Alt = alt
+	n.Title = title
+	// size and alignment are only available with an <img> element written in HTML
+	n.MaxWidth = imageSize(width)
+	n.MaxHeight = imageSize(height)
+	n.Sized = n.MaxWidth > 0 || n.MaxHeight > 0
+	switch a := types.ImageAlign(strings.ToLower(align)); a {
+	case types.ImageAlignLeft, types.ImageAlignRight, types.ImageAlignCenter:
+		n.Align = a
+	case "":
+	default:
+		ps.warn(types.SeverityWarning, ps.locateTag(ps.t.Data), "unknown image alignment %q", align)
+	}
+	return n
+}
+
+// imageSize returns the pixel size s of an <img> width or height attribute, such as "24" or "24px".
+// It returns 0 if s is not a valid size.
+func imageSize(s string) float32 {
+	f, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(s), "px"), 32)
+	if err != nil || f < 0 {
+		return 0
+	}
+	return float32(f)
 }
 
-// handleLink handles links and download buttons, both of which appear as <a> elements.
-// It assumes the tokenizer is pointing to the <a> tag itself.
-func handleLink(ps *parserState) {
-	var href string
+// videoLinks replaces the images among nodes which point to a YouTube video with links to the video,
+// reading as the image alt text. Videos are only embedded from a paragraph of their own.
+// It returns the resulting nodes.
+func videoLinks(nodes []types.Node) []types.Node {
+	for i, n := range nodes {
+		img, ok := n.(*types.ImageNode)
+		if !ok || youtubeID(img.Src) == "" {
+			continue
+		}
+		text := img.Alt
+		if text == "" {
+			text = img.Src
+		}
+		l := types.NewURLNode(img.Src, newBreaklessTextNode(text))
+		l.MutatePos(img.Pos())
+		nodes[i] = l
+	}
+	return nodes
+}
+
+// youtubeID returns the ID of the video s links to, if s is a youtube.com/watch, youtube.com/embed
+// or youtu.be URL. It returns an empty string otherwise.
+func youtubeID(s string) string {
+	u, err := url.Parse(s)
+	if err != nil {
+		return ""
+	}
+	host := strings.TrimPrefix(strings.ToLower(u.Host), "www.")
+	switch {
+	case host == "youtu.be":
+		return strings.Trim(u.Path, "/")
+	case host != "youtube.com" && host != "m.youtube.com":
+		return ""
+	case u.Path == "/watch":
+		return u.Query().Get("v")
+	case strings.HasPrefix(u.Path, "/embed/"):
+		return strings.Trim(strings.TrimPrefix(u.Path, "/embed/"), "/")
+	}
+	return ""
+}
+
+// handleLink handles links and buttons, both of which appear as <a> elements.
+// It assumes the tokenizer is pointing to the <a> tag itself, and leaves it pointing to </a>.
+// The link content may be any inline content, such as bold text, inline code or an image.
+//
+// A link is turned into a button if its title starts with the word "button", optionally followed
+// by the button styles, e.g. [Get the code](https://example.com/code.zip "button raised colored download").
+// Links whose text begins with "Download" are turned into buttons with all the styles enabled.
+func handleLink(ps *parserState) types.Node {
+	var href, title string
 	for _, v := range ps.t.Attr {
-		if v.Key == "href" {
+		switch v.Key {
+		case "href":
 			href = v.Val
+		case "title":
+			title = v.Val
 		}
 	}
-	// Advance to text.
-	ps.advance()
-	// Check for the download button case.
-	s := downloadButtonRegexp.FindStringSubmatch(ps.t.Data)
-	if len(s) >= 2 {
-		// It's a button, emit a button element with all the pretty styling enabled.
-		ps.emit(types.NewButtonNode(true, true, true, newBreaklessTextNode(s[1])))
-	} else {
+	from := ps.off
+	nodes := trimTrailingSpace(parseInlineUntil(ps, atom.A))
+	var btn *types.ButtonNode
+	if f := strings.Fields(strings.ToLower(title)); len(f) > 0 && f[0] == buttonTitle {
+		// It's a button with the styles chosen by the author.
+		btn = types.NewButtonNode(false, false, false, nodes...)
+		for _, s := range f[1:] {
+			switch s {
+			case buttonRaised:
+				btn.Raised = true
+			case buttonColored:
+				btn.Colored = true
+			case buttonDownload:
+				btn.Download = true
+			}
+		}
+	} else if t, ok := firstText(nodes); ok {
+		if s := downloadButtonRegexp.FindStringSubmatch(t.Value); len(s) >= 2 {
+			// It's a download button, emit a button element with all the pretty styling enabled.
+			nodes[0] = withText(t, s[1], t.Role)
+			btn = types.NewButtonNode(true, true, true, nodes...)
+		}
+	}
+	var n types.Node
+	switch {
+	case btn == nil:
 		// It's not a button, emit an ordinary link.
-		ps.emit(types.NewURLNode(href, newBreaklessTextNode(ps.t.Data)))
+		n = types.NewURLNode(href, nodes...)
+	case href == "":
+		n = btn
+	default:
+		n = types.NewURLNode(href, btn)
 	}
-	// Advance to </a>.
-	ps.advance()
+	// the content has been located already, which moved the source offset past it
+	n.MutatePos(ps.locate(nodeText(n), from))
+	return n
+}
+
+// firstText returns the first of nodes if it is a text node other than inline code.
+func firstText(nodes []types.Node) (*types.TextNode, bool) {
+	if len(nodes) == 0 {
+		return nil, false
+	}
+	t, ok := nodes[0].(*types.TextNode)
+	return t, ok && !t.Code
 }
 
 // handleFencedCodeBlock handles all code elements wrapped in ```s.
 // It assumes the tokenizer is pointing to the <pre> tag establishing the block.
-func handleFencedCodeBlock(ps *parserState) {
+func handleFencedCodeBlock(ps *parserState) types.Node {
 	// Advance to <code>.
 	ps.advance()
 	// Check for the presence of a language hint.
@@ -458,21 +1307,22 @@ func handleFencedCodeBlock(ps *parserState) {
 	ps.advance()
 	n := types.NewCodeNode(ps.t.Data, false)
 	n.Lang = lang
-	ps.emit(n)
 	// Advance to </pre>.
 	ps.multiAdvance(2)
+	return n
 }
 
+// handleInlineCodeBlock handles inlined code.
 // It assumes the tokenizer is pointing to the <code> tag establishing the block.
-func handleInlineCodeBlock(ps *parserState) {
+func handleInlineCodeBlock(ps *parserState) types.Node {
 	// Advance to text content.
 	ps.advance()
 	// Inlined code is actually a text node with special formatting.
 	n := types.NewTextNode(ps.t.Data)
 	n.Code = true
-	ps.emit(n)
 	// Advance to </code>.
 	ps.advance()
+	return n
 }
 
 // standardSplit takes a string, splits it along a comma delimiter, then on each fragment, trims Unicode spaces
@@ -487,6 +1337,7 @@ func standardSplit(s string) []string {
 
 // addMetadataToCodelab takes a map of strings to strings, and a pointer to a Codelab. It reads the keys of the map,
 // and assigns the values to any keys that match a codelab metadata field as defined by the meta* constants.
+// Values of any other keys are stored in the codelab's Extra metadata.
 func addMetadataToCodelab(m map[string]string, c *types.Codelab) {
 	for k, v := range m {
 		switch k {
@@ -527,12 +1378,79 @@ func addMetadataToCodelab(m map[string]string, c *types.Codelab) {
 			// Standardize the tags and append to the codelab field.
 			c.Tags = append(c.Tags, standardSplit(v)...)
 			break
+		case metaTitle:
+			// Directly assign the title to the codelab field.
+			c.Title = v
 		default:
-			break
+			// Keep unknown keys for the templates.
+			if c.Extra == nil {
+				c.Extra = make(map[string]string)
+			}
+			c.Extra[k] = v
 		}
 	}
 }
 
+// nodeText returns the first text found in n, used to locate n in the source.
+func nodeText(n types.Node) string {
+	switch n := n.(type) {
+	case *types.TextNode:
+		return n.Value
+	case *types.CodeNode:
+		return n.Value
+	case *types.ImageNode:
+		return n.Src
+	case *types.YouTubeNode:
+		return n.VideoID
+	case *types.ImportNode:
+		return n.URL
+	case *types.SurveyNode:
+		if len(n.Groups) > 0 {
+			return n.Groups[0].Name
+		}
+	case *types.ListNode:
+		for _, c := range n.Nodes {
+			if s := nodeText(c); strings.TrimSpace(s) != "" {
+				return s
+			}
+		}
+	case *types.ItemsListNode:
+		if len(n.Items) > 0 {
+			return nodeText(n.Items[0])
+		}
+	case *types.HeaderNode:
+		return nodeText(n.Content)
+	case *types.URLNode:
+		return nodeText(n.Content)
+	case *types.ButtonNode:
+		return nodeText(n.Content)
+	case *types.InfoboxNode:
+		return nodeText(n.Content)
+	case *types.GridNode:
+		if len(n.Rows) > 0 && len(n.Rows[0]) > 0 {
+			return nodeText(n.Rows[0][0].Content)
+		}
+	}
+	return ""
+}
+
+// searchText returns the first run of letters, digits and spaces in s, without surrounding spaces.
+// Such text is likely to be found verbatim in the Markdown source.
+func searchText(s string) string {
+	isText := func(r rune) bool {
+		return unicode.IsLetter(r) || unicode.IsDigit(r) || r == ' '
+	}
+	i := strings.IndexFunc(s, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) })
+	if i < 0 {
+		return ""
+	}
+	s = s[i:]
+	if j := strings.IndexFunc(s, func(r rune) bool { return !isText(r) }); j >= 0 {
+		s = s[:j]
+	}
+	return strings.TrimSpace(s)
+}
+
 // newBreaklessTextNode accepts a string, and constructs a new TextNode containing the string,
 // but replaces all line breaks in the string with spaces first. It returns a pointer to the created node.
 func newBreaklessTextNode(s string) *types.TextNode {
@@ -15,15 +15,19 @@
 package md
 
 import (
+	"bytes"
 	"fmt"
 	"reflect"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/CloudVLab/tools/claat/parser"
+	"github.com/CloudVLab/tools/claat/render"
 	"github.com/CloudVLab/tools/claat/types"
 
 	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
 )
 
 func buildParserWithStep(markup string) *parserState {
@@ -113,13 +117,80 @@ func TestHandleDurationHint(t *testing.T) {
 	for i, tc := range tests {
 		ps := buildParserWithStep(tc.in)
 		ps.advance()
-		handleDurationHint(ps)
+		handleStepHint(ps)
 		if ps.currentStep.Duration != tc.out {
 			t.Errorf("%d: [%q] got %v, want %v", i, tc.in, ps.currentStep.Duration, tc.out)
 		}
 	}
 }
 
+func TestInvalidDurationHint(t *testing.T) {
+	const markup = "# Title\n\n## Step\nThe Duration of this step varies.\n\n## Next\nDuration: 1:xx\n\nText.\n"
+	c, err := (&Parser{}).Parse(strings.NewReader(markup), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"<p>The Duration of this step varies.</p>\n",
+		"<p>Duration: 1:xx</p>\n<p>Text.</p>\n",
+	}
+	for i, st := range c.Steps {
+		if st.Duration != 0 {
+			t.Errorf("step %d duration = %v; want 0", i+1, st.Duration)
+		}
+		if h, _ := render.HTML("", st.Content.Nodes...); string(h) != want[i] {
+			t.Errorf("step %d content = %q; want %q", i+1, h, want[i])
+		}
+	}
+	if len(c.Warnings) != 1 {
+		t.Errorf("warnings = %v; want 1 invalid duration warning", c.Warnings)
+	}
+}
+
+func TestParseStepEnvironment(t *testing.T) {
+	const markup = "## Step\n" +
+		"Duration: 5:00\n\n" +
+		"Environment: Web, kiosk\n\n" +
+		"For everyone.\n\n" +
+		"### Kiosk only\n" +
+		"Environment: kiosk\n\n" +
+		"Ask for help.\n\n" +
+		"Environment: all\n\n" +
+		"Back to everyone.\n\n" +
+		"Environment: web\n\n" +
+		"### For everyone again\n"
+	ps := parserState{
+		tzr: html.NewTokenizer(bytes.NewReader(claatMarkdown([]byte(markup)))),
+		c:   &types.Codelab{Meta: types.Meta{Tags: []string{"web"}}},
+	}
+	ps.multiAdvance(2)
+	ps.currentStep = ps.c.NewStep(ps.t.Data)
+	ps.advance()
+	if err := parseStep(&ps); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"kiosk", "web"}; !reflect.DeepEqual(ps.currentStep.Tags, want) {
+		t.Errorf("step tags = %v; want %v", ps.currentStep.Tags, want)
+	}
+	if want := []string{"web", "kiosk"}; !reflect.DeepEqual(ps.c.Tags, want) {
+		t.Errorf("codelab tags = %v; want %v", ps.c.Tags, want)
+	}
+	if ps.currentStep.Duration != 5*time.Hour {
+		t.Errorf("duration = %v; want %v", ps.currentStep.Duration, 5*time.Hour)
+	}
+	wantEnv := [][]string{nil, {"kiosk"}, {"kiosk"}, nil, nil}
+	nodes := ps.currentStep.Content.Nodes
+	if len(nodes) != len(wantEnv) {
+		t.Fatalf("len(nodes) = %d; want %d", len(nodes), len(wantEnv))
+	}
+	for i, n := range nodes {
+		if !reflect.DeepEqual(n.Env(), wantEnv[i]) {
+			t.Errorf("%d: %T env = %v; want %v", i, n, n.Env(), wantEnv[i])
+		}
+	}
+}
+
 func TestComputeTotalDuration(t *testing.T) {
 	tests := []struct {
 		in  []time.Duration
@@ -185,6 +256,8 @@ func TestAddMetadataToCodelab(t *testing.T) {
 				"status":            "draft",
 				"feedback link":     "https://www.google.com",
 				"analytics account": "12345",
+				"title":             "Codelab title",
+				"level":             "introductory",
 			},
 			types.Codelab{
 				Meta: types.Meta{
@@ -196,6 +269,8 @@ func TestAddMetadataToCodelab(t *testing.T) {
 					Status:     &tempStatus,
 					Feedback:   "https://www.google.com",
 					GA:         "12345",
+					Title:      "Codelab title",
+					Extra:      map[string]string{"level": "introductory"},
 				},
 			},
 		},
@@ -224,3 +299,606 @@ func TestNewBreaklessTextNode(t *testing.T) {
 		}
 	}
 }
+
+func TestParseFragment(t *testing.T) {
+	const markup = `
+Some **shared** text.
+
+[[**import** [nested](https://example.com/nested.md)]]
+`
+	p := &Parser{}
+	nodes, warn, err := p.ParseFragment(strings.NewReader(markup), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warn) != 0 {
+		t.Errorf("ParseFragment warnings: %v", warn)
+	}
+
+	at := func(n types.Node, line, col int) types.Node {
+		n.MutatePos(types.Pos{Line: line, Col: col})
+		return n
+	}
+	b := newBreaklessTextNode("shared")
+	b.Bold = true
+	para := types.NewListNode(
+		at(newBreaklessTextNode("Some "), 2, 1),
+		at(b, 2, 8),
+		at(newBreaklessTextNode(" text."), 2, 17),
+	)
+	para.MutateBlock(true)
+	want := []types.Node{
+		at(para, 2, 1),
+		at(types.NewImportNode("https://example.com/nested.md"), 4, 5),
+	}
+	if !reflect.DeepEqual(nodes, want) {
+		t.Errorf("ParseFragment:\n%+v\nwant:\n%+v", nodes, want)
+	}
+}
+
+func TestParseFragmentTitle(t *testing.T) {
+	const markup = "Intro text.\n\n## Step title\n\nMore text.\n\nSetext title\n------------\n"
+	nodes, warn, err := (&Parser{}).ParseFragment(strings.NewReader(markup), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out []string
+	for _, w := range warn {
+		out = append(out, w.Severity.String()+" "+w.String())
+	}
+	want := []string{
+		`warn 3:4: title "Step title" ignored: fragments cannot start steps, use ### headers instead`,
+		`warn 7:1: title "Setext title" ignored: fragments cannot start steps, use ### headers instead`,
+	}
+	if !reflect.DeepEqual(out, want) {
+		t.Errorf("ParseFragment warnings:\n%q\nwant:\n%q", out, want)
+	}
+	h, _ := render.HTML("", nodes...)
+	if v, want := string(h), "<p>Intro text.</p>\n<p>More text.</p>\n"; v != want {
+		t.Errorf("fragment = %q; want %q", v, want)
+	}
+}
+
+func TestParsePositions(t *testing.T) {
+	const markup = "id: positions\n\n" +
+		"# Title\n\n" +
+		"## First step\n" +
+		"Duration: 1:00\n\n" +
+		"Some text.\n\n" +
+		"### A header\n\n" +
+		"```\n" +
+		"code\n" +
+		"```\n"
+	c, err := (&Parser{}).Parse(strings.NewReader(markup), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Steps) != 1 {
+		t.Fatalf("len(c.Steps) = %d; want 1", len(c.Steps))
+	}
+	st := c.Steps[0]
+	if want := (types.Pos{Line: 5, Col: 4}); st.Pos != want {
+		t.Errorf("step pos = %v; want %v", st.Pos, want)
+	}
+	want := []types.Pos{{Line: 8, Col: 1}, {Line: 10, Col: 5}, {Line: 13, Col: 1}}
+	if len(st.Content.Nodes) != len(want) {
+		t.Fatalf("len(nodes) = %d; want %d", len(st.Content.Nodes), len(want))
+	}
+	for i, n := range st.Content.Nodes {
+		if n.Pos() != want[i] {
+			t.Errorf("%d: %T pos = %v; want %v", i, n, n.Pos(), want[i])
+		}
+	}
+}
+
+func TestParseMetadataError(t *testing.T) {
+	const markup = "id: positions\n\nnot metadata\n\n# Title\n"
+	_, err := (&Parser{}).Parse(strings.NewReader(markup), false)
+	if err == nil || !strings.HasPrefix(err.Error(), "3:1: ") {
+		t.Errorf("Parse: %v; want an error at 3:1", err)
+	}
+}
+
+func TestParseWarnings(t *testing.T) {
+	const markup = "id: warnings\n\n" +
+		"# Title\n\n" +
+		"## First step\n" +
+		"Duration: 1:xx\n\n" +
+		"[[**unknown** [thing](https://example.com)]]\n\n" +
+		"[[**import** *not a link*]]\n\n" +
+		"Text with <img alt=\"no source\"> image.\n\n" +
+		"<div>Raw HTML</div>\n"
+	c, err := (&Parser{}).Parse(strings.NewReader(markup), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out []string
+	for _, w := range c.Warnings {
+		out = append(out, w.Severity.String()+" "+w.String())
+	}
+	want := []string{
+		`warn 6:1: invalid step duration "1:xx": unrecognized duration string`,
+		`warn 8:5: unknown directive [[unknown]]`,
+		`err 10:5: [[import]]: needs a single link argument`,
+		`warn 12:21: image "no source" without source ignored`,
+		`warn 14:1: unsupported element <div>`,
+	}
+	if !reflect.DeepEqual(out, want) {
+		t.Errorf("c.Warnings:\n%q\nwant:\n%q", out, want)
+	}
+}
+
+func TestHandleDirective(t *testing.T) {
+	code := types.NewCodeNode("", false)
+	code.Lang = "go"
+	code.Include = &types.CodeInclude{URL: "samples/main.go", Start: 10, End: 20}
+	code.MutateBlock(true)
+	tests := []struct {
+		in           string
+		parseImports bool
+		out          types.Node
+	}{
+		{`<p>[[<strong>import</strong> <a href="https://example.com/shared.md">shared</a>]]</p>`, true, types.NewImportNode("https://example.com/shared.md")},
+		{`<p>[[<strong>Import</strong> <a href="shared.md">shared</a>]]</p>`, true, types.NewImportNode("shared.md")},
+		// Imports are not parsed if the parser is told to skip them.
+		{`<p>[[<strong>import</strong> <a href="https://example.com/shared.md">shared</a>]]</p>`, false, nil},
+		// The directive name must be bold.
+		{`<p>[[import <a href="https://example.com/shared.md">shared</a>]]</p>`, true, nil},
+		// The argument must be a link.
+		{`<p>[[<strong>import</strong> shared.md]]</p>`, true, nil},
+		// Code is included from a source file, with a text argument before the closing brackets.
+		{`<p>[[<strong>code</strong> <a href="samples/main.go">main.go</a> 10-20]]</p>`, true, code},
+		// Unknown directives are left as is.
+		{`<p>[[<strong>unknown</strong> <a href="https://example.com/shared.md">shared</a>]]</p>`, true, nil},
+	}
+	for i, tc := range tests {
+		ps := buildParserWithStep(tc.in)
+		ps.parseImports = tc.parseImports
+		ps.advance()
+		nodes := parseInlineUntil(ps, atom.P)
+		out := handleDirective(ps, nodes)
+		if !reflect.DeepEqual(out, tc.out) {
+			t.Errorf("%d: handleDirective(%q) = %+v; want %+v", i, tc.in, out, tc.out)
+		}
+	}
+}
+
+func TestRegisteredDirective(t *testing.T) {
+	parser.RegisterDirective("md-test", func(d *parser.Directive) (types.Node, error) {
+		if len(d.Args) != 1 {
+			return nil, fmt.Errorf("got %d args", len(d.Args))
+		}
+		n := types.NewInfoboxNode(types.InfoboxNote, d.Args...)
+		return n, nil
+	})
+	ps := buildParserWithStep(`<p>[[<strong>md-test</strong> <em>content</em>]]</p>`)
+	ps.advance()
+	out := handleDirective(ps, parseInlineUntil(ps, atom.P))
+	it := newBreaklessTextNode("content")
+	it.Italic = true
+	if want := types.NewInfoboxNode(types.InfoboxNote, it); !reflect.DeepEqual(out, types.Node(want)) {
+		t.Errorf("handleDirective = %+v; want %+v", out, want)
+	}
+
+	ps = buildParserWithStep(`<p>[[<strong>md-test</strong>]]</p>`)
+	ps.advance()
+	if out := handleDirective(ps, parseInlineUntil(ps, atom.P)); out != nil {
+		t.Errorf("handleDirective = %+v; want nil", out)
+	}
+	if len(ps.warnings) != 1 || ps.warnings[0].Msg != "[[md-test]]: got 0 args" {
+		t.Errorf("ps.warnings = %v; want the directive error", ps.warnings)
+	}
+}
+
+func TestHandleList(t *testing.T) {
+	const markup = "1. Run `gcloud init` in **Cloud Shell**\n" +
+		"2. Open [the console](https://console.cloud.google.com)\n" +
+		"    * nested ![icon](icon.png)\n" +
+		"    * items\n"
+	ps := buildParserWithStep(string(claatMarkdown([]byte(markup))))
+	ps.advance()
+	n := handleList(ps)
+
+	code := newBreaklessTextNode("gcloud init")
+	code.Code = true
+	bold := newBreaklessTextNode("Cloud Shell")
+	bold.Bold = true
+	img := types.NewImageNode("icon.png")
+	img.Alt = "icon"
+	nested := types.NewItemsListNode("", 0)
+	nested.NewItem(newBreaklessTextNode("nested "), img)
+	nested.NewItem(newBreaklessTextNode("items"))
+	want := types.NewItemsListNode("", 1)
+	want.NewItem(newBreaklessTextNode("Run "), code, newBreaklessTextNode(" in "), bold)
+	want.NewItem(
+		newBreaklessTextNode("Open "),
+		types.NewURLNode("https://console.cloud.google.com", newBreaklessTextNode("the console")),
+		nested,
+	)
+	if !reflect.DeepEqual(n, types.Node(want)) {
+		t.Errorf("handleList:\n%+v\nwant:\n%+v", n, want)
+	}
+}
+
+func TestLooseListItem(t *testing.T) {
+	const markup = "1. Run the app:\n\n    ```bash\n    go run .\n    ```\n\n    It prints hello.\n\n2. Stop it.\n"
+	nodes, _, err := (&Parser{}).ParseFragment(strings.NewReader(markup), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "<ol start=\"1\">\n<li>Run the app:\n<pre><code language=\"bash\" class=\"bash\">go run .\n</code></pre>\n" +
+		"<p>It prints hello.</p>\n</li>\n<li>Stop it.\n</li>\n</ol>\n"
+	h, _ := render.HTML("", nodes...)
+	if v := string(h); v != want {
+		t.Errorf("list = %q; want %q", v, want)
+	}
+
+	// Markdown output reads back the same
+	md, _ := render.MD("", nodes...)
+	nodes, _, err = (&Parser{}).ParseFragment(strings.NewReader(md), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h, _ = render.HTML("", nodes...); string(h) != want {
+		t.Errorf("list of %q = %q; want %q", md, h, want)
+	}
+}
+
+func TestHandleTable(t *testing.T) {
+	const markup = "| Name | Value |\n" +
+		"|------|-------|\n" +
+		"| *zone* | `us-central1-a` |\n" +
+		"| empty | |\n"
+	ps := buildParserWithStep(string(claatMarkdown([]byte(markup))))
+	ps.advance()
+	n := handleTable(ps)
+
+	cell := func(header bool, nodes ...types.Node) *types.GridCell {
+		return &types.GridCell{Colspan: 1, Rowspan: 1, Header: header, Content: types.NewListNode(nodes...)}
+	}
+	ita := newBreaklessTextNode("zone")
+	ita.Italic = true
+	code := newBreaklessTextNode("us-central1-a")
+	code.Code = true
+	want := types.NewGridNode(
+		[]*types.GridCell{cell(true, newBreaklessTextNode("Name")), cell(true, newBreaklessTextNode("Value"))},
+		[]*types.GridCell{cell(false, ita), cell(false, code)},
+		[]*types.GridCell{cell(false, newBreaklessTextNode("empty")), cell(false)},
+	)
+	if !reflect.DeepEqual(n, types.Node(want)) {
+		t.Errorf("handleTable:\n%+v\nwant:\n%+v", n, want)
+	}
+}
+
+func TestHandleInfobox(t *testing.T) {
+	const markup = "Note\n" +
+		": First paragraph with a [link](https://example.com).\n\n" +
+		"    Second paragraph:\n\n" +
+		"    ```\n" +
+		"    ls -l\n" +
+		"    ```\n\n" +
+		"    * one\n" +
+		"    * two\n\n" +
+		"Term\n" +
+		": Description.\n"
+	ps := buildParserWithStep(string(claatMarkdown([]byte(markup))))
+	ps.advance()
+	handleDefinitionList(ps)
+
+	para := func(nodes ...types.Node) *types.ListNode {
+		p := types.NewListNode(nodes...)
+		p.MutateBlock(true)
+		return p
+	}
+	list := types.NewItemsListNode("", 0)
+	list.NewItem(newBreaklessTextNode("one"))
+	list.NewItem(newBreaklessTextNode("two"))
+	term := newBreaklessTextNode("Term")
+	term.Bold = true
+	want := []types.Node{
+		types.NewInfoboxNode(types.InfoboxNote,
+			para(
+				newBreaklessTextNode("First paragraph with a "),
+				types.NewURLNode("https://example.com", newBreaklessTextNode("link")),
+				newBreaklessTextNode("."),
+			),
+			para(newBreaklessTextNode("Second paragraph:")),
+			types.NewCodeNode("ls -l\n", false),
+			list,
+		),
+		para(term),
+		para(newBreaklessTextNode("Description.")),
+	}
+	if out := ps.currentStep.Content.Nodes; !reflect.DeepEqual(out, want) {
+		t.Errorf("handleDefinitionList:\n%+v\nwant:\n%+v", out, want)
+	}
+}
+
+func TestHandleDefinitionList(t *testing.T) {
+	const markup = "Survey\n" +
+		": How will you use this codelab?\n" +
+		"    * Only read through it\n" +
+		"    * Read it and complete the exercises\n" +
+		"\n" +
+		": How would you rate your experience?\n" +
+		"    * Novice\n" +
+		"    * Proficient\n" +
+		"\n" +
+		"Positive\n" +
+		": Best *practice*.\n" +
+		"\n" +
+		"Survey\n" +
+		": Did it work?\n" +
+		"    * Yes\n" +
+		"    * No\n"
+	ps := buildParserWithStep(string(claatMarkdown([]byte(markup))))
+	ps.c.ID = "clab"
+	ps.survey = 1
+	ps.advance()
+	handleDefinitionList(ps)
+
+	ita := newBreaklessTextNode("practice")
+	ita.Italic = true
+	para := types.NewListNode(newBreaklessTextNode("Best "), ita, newBreaklessTextNode("."))
+	para.MutateBlock(true)
+	want := []types.Node{
+		types.NewSurveyNode("clab-2",
+			&types.SurveyGroup{
+				Name:    "How will you use this codelab?",
+				Options: []string{"Only read through it", "Read it and complete the exercises"},
+			},
+			&types.SurveyGroup{
+				Name:    "How would you rate your experience?",
+				Options: []string{"Novice", "Proficient"},
+			},
+		),
+		types.NewInfoboxNode(types.InfoboxPositive, para),
+		types.NewSurveyNode("clab-3", &types.SurveyGroup{Name: "Did it work?", Options: []string{"Yes", "No"}}),
+	}
+	if out := ps.currentStep.Content.Nodes; !reflect.DeepEqual(out, want) {
+		t.Errorf("handleDefinitionList:\n%+v\nwant:\n%+v", out, want)
+	}
+}
+
+func TestHandleLink(t *testing.T) {
+	bold := newBreaklessTextNode("Save")
+	bold.Bold = true
+	code := newBreaklessTextNode("main.go")
+	code.Code = true
+	img := types.NewImageNode("run.png")
+	img.Alt = "run"
+	tests := []struct {
+		in  string
+		out types.Node
+	}{
+		{
+			`<a href="https://example.com">Example</a>`,
+			types.NewURLNode("https://example.com", newBreaklessTextNode("Example")),
+		},
+		{
+			`<a href="https://example.com/sdk.zip">Download SDK</a>`,
+			types.NewURLNode("https://example.com/sdk.zip", types.NewButtonNode(true, true, true, newBreaklessTextNode(" SDK"))),
+		},
+		{
+			`<a href="https://example.com/code.zip" title="button colored download">Get the code</a>`,
+			types.NewURLNode("https://example.com/code.zip", types.NewButtonNode(false, true, true, newBreaklessTextNode("Get the code"))),
+		},
+		{
+			`<a href="https://console.cloud.google.com" title="Button Raised">Open the console</a>`,
+			types.NewURLNode("https://console.cloud.google.com", types.NewButtonNode(true, false, false, newBreaklessTextNode("Open the console"))),
+		},
+		// Other titles do not make a button.
+		{
+			`<a href="https://example.com" title="buttons">Example</a>`,
+			types.NewURLNode("https://example.com", newBreaklessTextNode("Example")),
+		},
+		// Links may contain any inline content.
+		{
+			`<a href="https://example.com" title="button">Click <strong>Save</strong></a>`,
+			types.NewURLNode("https://example.com", types.NewButtonNode(false, false, false,
+				newBreaklessTextNode("Click "), bold)),
+		},
+		{
+			`<a href="https://example.com/main.go"><code>main.go</code></a>`,
+			types.NewURLNode("https://example.com/main.go", code),
+		},
+		{
+			`<a href="https://example.com/run"><img src="run.png" alt="run"/></a>`,
+			types.NewURLNode("https://example.com/run", img),
+		},
+	}
+	for i, tc := range tests {
+		ps := buildParserWithStep(tc.in)
+		ps.advance()
+		out := handleLink(ps)
+		if !reflect.DeepEqual(out, tc.out) {
+			t.Errorf("%d: handleLink(%q) = %+v; want %+v", i, tc.in, out, tc.out)
+		}
+	}
+}
+
+func TestParseLinkContent(t *testing.T) {
+	const markup = "* [**Save**](https://example.com/save) and [`main.go`](https://example.com/main.go)\n" +
+		"* [![run](run.png)](https://example.com/run)\n" +
+		"* ~~[old](https://example.com/old)~~\n"
+	nodes, _, err := (&Parser{}).ParseFragment(strings.NewReader(markup), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "<ul>\n" +
+		`<li><a href="https://example.com/save" target="_blank"><strong>Save</strong></a> and ` +
+		`<a href="https://example.com/main.go" target="_blank"><code>main.go</code></a></li>` + "\n" +
+		`<li><a href="https://example.com/run" target="_blank"><img alt="run" src="run.png"></a></li>` + "\n" +
+		`<li><a href="https://example.com/old" target="_blank"><s>old</s></a></li>` + "\n" +
+		"</ul>\n"
+	h, _ := render.HTML("", nodes...)
+	if v := string(h); v != want {
+		t.Errorf("list = %q; want %q", v, want)
+	}
+}
+
+func TestImageCaption(t *testing.T) {
+	const markup = `
+![Cloud Shell](img/shell.png "Activate Cloud Shell")
+*The Cloud Shell button*
+
+![Editor](img/editor.png) and *italic text*.
+`
+	nodes, _, err := (&Parser{}).ParseFragment(strings.NewReader(markup), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 2 {
+		t.Fatalf("len(nodes) = %d; want 2", len(nodes))
+	}
+	// captioned image
+	para := nodes[0].(*types.ListNode)
+	if len(para.Nodes) != 1 {
+		t.Fatalf("captioned paragraph: %d nodes; want 1", len(para.Nodes))
+	}
+	img := para.Nodes[0].(*types.ImageNode)
+	if img.Alt != "Cloud Shell" || img.Title != "Activate Cloud Shell" || img.Caption != "The Cloud Shell button" {
+		t.Errorf("image alt, title, caption = %q, %q, %q", img.Alt, img.Title, img.Caption)
+	}
+	// text after an image is not a caption
+	para = nodes[1].(*types.ListNode)
+	img = para.Nodes[0].(*types.ImageNode)
+	if img.Alt != "Editor" || img.Title != "" || img.Caption != "" || len(para.Nodes) == 1 {
+		t.Errorf("image alt, title, caption = %q, %q, %q; %d nodes", img.Alt, img.Title, img.Caption, len(para.Nodes))
+	}
+}
+
+func TestImageLayout(t *testing.T) {
+	const markup = `
+<img src="img/diagram.png" alt="Diagram" width="600" height="400px" align="center">
+
+Click ![Run](img/run.png) to run the app.
+
+![One](img/one.png) ![Two](img/two.png)
+`
+	nodes, warn, err := (&Parser{}).ParseFragment(strings.NewReader(markup), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warn) != 0 {
+		t.Errorf("ParseFragment warnings: %v", warn)
+	}
+	var images []*types.ImageNode
+	for _, n := range nodes {
+		for _, cn := range n.(*types.ListNode).Nodes {
+			if img, ok := cn.(*types.ImageNode); ok {
+				images = append(images, img)
+			}
+		}
+	}
+	tests := []struct {
+		width, height float32
+		align         types.ImageAlign
+		inline        bool
+	}{
+		{600, 400, types.ImageAlignCenter, false},
+		{0, 0, "", true},
+		{0, 0, "", false},
+		{0, 0, "", false},
+	}
+	if len(images) != len(tests) {
+		t.Fatalf("%d images; want %d", len(images), len(tests))
+	}
+	for i, tc := range tests {
+		img := images[i]
+		if img.MaxWidth != tc.width || img.MaxHeight != tc.height || img.Align != tc.align || img.Inline != tc.inline {
+			t.Errorf("%d: size = %vx%v, align = %q, inline = %v; want %vx%v, %q, %v", i,
+				img.MaxWidth, img.MaxHeight, img.Align, img.Inline, tc.width, tc.height, tc.align, tc.inline)
+		}
+	}
+}
+
+func TestTextStyles(t *testing.T) {
+	const markup = `H<sub>2</sub>O is ~~v1~~ v2, x<sup>2</sup> and <u>that</u>.`
+	nodes, warn, err := (&Parser{}).ParseFragment(strings.NewReader(markup), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warn) != 0 {
+		t.Errorf("ParseFragment warnings: %v", warn)
+	}
+	want := "H<sub>2</sub>O is <s>v1</s> v2, x<sup>2</sup> and <u>that</u>."
+	h, _ := render.HTML("", nodes[0].(*types.ListNode).Nodes...)
+	if v := string(h); v != want {
+		t.Errorf("text = %q; want %q", v, want)
+	}
+}
+
+func TestRoleSpans(t *testing.T) {
+	const markup = "Replace [PROJECT_ID]{.placeholder} and [`REGION`]{.placeholder}, click [**Save**]{.ui}, " +
+		"[Open **Menu** now]{.ui} or [Done]{.ui}, not [this]{.other}, [**that**]{.other} or `[code]{.ui}`."
+	nodes, _, err := (&Parser{}).ParseFragment(strings.NewReader(markup), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `Replace <span class="placeholder">PROJECT_ID</span> and <span class="placeholder"><code>REGION</code></span>, ` +
+		`click <span class="ui"><strong>Save</strong></span>, ` +
+		`<span class="ui">Open </span><span class="ui"><strong>Menu</strong></span><span class="ui"> now</span> or ` +
+		`<span class="ui">Done</span>, not [this]{.other}, [<strong>that</strong>]{.other} or <code>[code]{.ui}</code>.`
+	h, _ := render.HTML("", nodes[0].(*types.ListNode).Nodes...)
+	if v := string(h); v != want {
+		t.Errorf("text = %q; want %q", v, want)
+	}
+
+	// Markdown output of styled roles reads back the same
+	md, _ := render.MD("", nodes...)
+	nodes, _, err = (&Parser{}).ParseFragment(strings.NewReader(string(md)), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, _ = render.HTML("", nodes[0].(*types.ListNode).Nodes...)
+	if v := string(h); v != want {
+		t.Errorf("text of %q = %q; want %q", md, v, want)
+	}
+}
+
+func TestYouTube(t *testing.T) {
+	tests := []struct {
+		in string
+		id string
+	}{
+		{"https://www.youtube.com/watch?v=vid1", "vid1"},
+		{"https://youtube.com/watch?v=vid2&t=10s", "vid2"},
+		{"https://youtu.be/vid3", "vid3"},
+		{"https://www.youtube.com/embed/vid4", "vid4"},
+		{"https://www.youtube.com/channel/xyz", ""},
+		{"https://example.com/watch?v=vid5", ""},
+		{"img/youtube.png", ""},
+	}
+	for i, tc := range tests {
+		ps := buildParserWithStep(fmt.Sprintf(`<p><img src="%s" alt="video"/></p>`, tc.in))
+		ps.advance()
+		n := handleParagraph(ps)
+		if tc.id == "" {
+			if n.Type() == types.NodeYouTube {
+				t.Errorf("%d: %q: got YouTube node", i, tc.in)
+			}
+			continue
+		}
+		want := types.NewYouTubeNode(tc.id)
+		want.MutateBlock(true)
+		if !reflect.DeepEqual(n, types.Node(want)) {
+			t.Errorf("%d: %q: got %+v; want %+v", i, tc.in, n, want)
+		}
+	}
+}
+
+func TestInlineYouTube(t *testing.T) {
+	const markup = "Watch ![the demo](https://youtu.be/vid1) first.\n\n" +
+		"* ![](https://www.youtube.com/watch?v=vid2)\n"
+	nodes, _, err := (&Parser{}).ParseFragment(strings.NewReader(markup), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<p>Watch <a href="https://youtu.be/vid1" target="_blank">the demo</a> first.</p>` + "\n" +
+		"<ul>\n" + `<li><a href="https://www.youtube.com/watch?v=vid2" target="_blank">https://www.youtube.com/watch?v=vid2</a></li>` + "\n</ul>\n"
+	h, _ := render.HTML("", nodes...)
+	if v := string(h); v != want {
+		t.Errorf("content = %q; want %q", v, want)
+	}
+}
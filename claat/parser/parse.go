@@ -26,12 +26,18 @@ import (
 // Each parser needs to call Register to become a known parser.
 type Parser interface {
 	// Parse parses source r into a Codelab for the specified environment env.
+	// Non-fatal problems found in r are reported in the Warnings field of the Codelab.
 	Parse(r io.Reader, parseImports bool) (*types.Codelab, error)
 
 	// ParseFragment is similar to Parse except it doesn't parse codelab metadata.
-	ParseFragment(r io.Reader, parseImports bool) ([]types.Node, error)
+	// Non-fatal problems found in r are returned as warnings.
+	ParseFragment(r io.Reader, parseImports bool) ([]types.Node, []*types.Warning, error)
 }
 
+// MsgDerivedID is the message of the warning parsers report
+// when a codelab has no ID and its ID is derived from the title instead.
+const MsgDerivedID = "missing codelab ID, derived from the title"
+
 var (
 	parsersMu sync.Mutex // guards parsers
 	parsers   = make(map[string]Parser)
@@ -59,15 +65,30 @@ func Parsers() []string {
 	return p
 }
 
-// Parse parses source r into a Codelab using a parser registered with
-// the specified name.
-func Parse(name string, r io.Reader, parseFragments bool) (*types.Codelab, error) {
+// Lookup returns the parser registered under specified name.
+func Lookup(name string) (Parser, error) {
 	parsersMu.Lock()
 	p, ok := parsers[name]
 	parsersMu.Unlock()
 	if !ok {
 		return nil, fmt.Errorf("no parser named %q", name)
 	}
+	return p, nil
+}
+
+// Parse parses source r into a Codelab using a parser registered with
+// the specified name.
+func Parse(name string, r io.Reader, parseFragments bool) (*types.Codelab, error) {
+	p, err := Lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	return ParseWith(p, r, parseFragments)
+}
+
+// ParseWith is the same as Parse, except that r is parsed with parser p,
+// which need not be registered, e.g. a parser with non-default settings.
+func ParseWith(p Parser, r io.Reader, parseFragments bool) (*types.Codelab, error) {
 	c, err := p.Parse(r, parseFragments)
 	if err != nil {
 		return nil, err
@@ -78,12 +99,10 @@ func Parse(name string, r io.Reader, parseFragments bool) (*types.Codelab, error
 
 // ParseFragment parses a codelab fragment provided in r, using a parser
 // registered with the specified name.
-func ParseFragment(name string, r io.Reader, parseFragments bool) ([]types.Node, error) {
-	parsersMu.Lock()
-	p, ok := parsers[name]
-	parsersMu.Unlock()
-	if !ok {
-		return nil, fmt.Errorf("no parser named %q", name)
+func ParseFragment(name string, r io.Reader, parseFragments bool) ([]types.Node, []*types.Warning, error) {
+	p, err := Lookup(name)
+	if err != nil {
+		return nil, nil, err
 	}
 	return p.ParseFragment(r, parseFragments)
 }
@@ -0,0 +1,468 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"sort"
+	"strings"
+)
+
+// Theme is a color theme of code highlighted server-side.
+// Values are CSS colors, applied with inline styles, so that highlighted code
+// needs neither scripts nor stylesheets.
+type Theme struct {
+	Background string // code block background
+	Foreground string // plain code text
+	Keyword    string // language keywords and literals, markup tag names
+	String     string // string and character literals, markup attribute values
+	Comment    string // comments, shown in italics
+	Number     string // number literals
+}
+
+// themes are the built-in themes, keyed by name.
+var themes = map[string]*Theme{
+	"light": {
+		Background: "#f6f8fa",
+		Foreground: "#24292e",
+		Keyword:    "#d73a49",
+		String:     "#032f62",
+		Comment:    "#6a737d",
+		Number:     "#005cc5",
+	},
+	"dark": {
+		Background: "#272822",
+		Foreground: "#f8f8f2",
+		Keyword:    "#f92672",
+		String:     "#e6db74",
+		Comment:    "#75715e",
+		Number:     "#ae81ff",
+	},
+}
+
+// LookupTheme returns the built-in highlighting theme of the specified name, if any.
+func LookupTheme(name string) (*Theme, bool) {
+	t, ok := themes[strings.ToLower(name)]
+	return t, ok
+}
+
+// Themes returns a sorted slice of all built-in theme names.
+func Themes() []string {
+	names := make([]string, 0, len(themes))
+	for k := range themes {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// preStyle returns the inline style of a highlighted code block.
+func (t *Theme) preStyle() string {
+	return "background-color: " + t.Background + "; color: " + t.Foreground
+}
+
+// tokenStyle returns the inline style of a token of kind k,
+// or an empty string for plain text.
+func (t *Theme) tokenStyle(k tokenKind) string {
+	switch k {
+	case tokenKeyword:
+		return "color: " + t.Keyword
+	case tokenString:
+		return "color: " + t.String
+	case tokenComment:
+		return "color: " + t.Comment + "; font-style: italic"
+	case tokenNumber:
+		return "color: " + t.Number
+	}
+	return ""
+}
+
+// tokenKind is the kind of a highlighted code token.
+type tokenKind int
+
+const (
+	tokenText tokenKind = iota
+	tokenKeyword
+	tokenString
+	tokenComment
+	tokenNumber
+)
+
+// token is a piece of highlighted code.
+type token struct {
+	kind tokenKind
+	text string
+}
+
+// syntax is the lexical syntax of a code language, just enough to highlight it.
+type syntax struct {
+	lineComments  []string    // line comment prefixes, e.g. "//"
+	blockComments [][2]string // block comment delimiters, e.g. "/*" and "*/"
+	quotes        string      // string delimiters; strings quoted with ` may span lines
+	tripleQuotes  bool        // whether strings may be quoted with """ or '''
+	ignoreCase    bool        // whether keywords are case-insensitive
+	markup        bool        // whether the language is HTML-like markup
+	keywords      map[string]bool
+}
+
+// words returns a set of the space-separated words of s.
+func words(s string) map[string]bool {
+	m := make(map[string]bool)
+	for _, w := range strings.Fields(s) {
+		m[w] = true
+	}
+	return m
+}
+
+var (
+	cComments   = []string{"//"}
+	cBlocks     = [][2]string{{"/*", "*/"}}
+	hashComment = []string{"#"}
+)
+
+// syntaxes are the code languages which can be highlighted, keyed by the language names
+// of types.CodeNode.
+var syntaxes = map[string]*syntax{
+	"bash": {
+		lineComments: hashComment,
+		quotes:       `"'`,
+		keywords:     words("if then else elif fi for while until do done case esac in function return local export echo exit"),
+	},
+	"c": {
+		lineComments: cComments, blockComments: cBlocks, quotes: `"'`,
+		keywords: words("auto break case char const continue default do double else enum extern float for goto if int long " +
+			"register return short signed sizeof static struct switch typedef union unsigned void volatile while NULL"),
+	},
+	"cpp": {
+		lineComments: cComments, blockComments: cBlocks, quotes: `"'`,
+		keywords: words("auto bool break case catch char class const continue default delete do double else enum explicit " +
+			"extern false float for friend goto if inline int long namespace new nullptr operator private protected public " +
+			"return short signed sizeof static struct switch template this throw true try typedef typename union unsigned " +
+			"using virtual void volatile while"),
+	},
+	"csharp": {
+		lineComments: cComments, blockComments: cBlocks, quotes: `"'`,
+		keywords: words("abstract as async await bool break case catch class const continue default do double else enum " +
+			"false finally float for foreach if in int interface internal is long namespace new null object out override " +
+			"private protected public readonly return static string struct switch this throw true try using var virtual void while"),
+	},
+	"css": {
+		blockComments: cBlocks, quotes: `"'`,
+		keywords: words("important inherit initial none auto"),
+	},
+	"dart": {
+		lineComments: cComments, blockComments: cBlocks, quotes: `"'`,
+		keywords: words("abstract async await bool break case catch class const continue default do double dynamic else " +
+			"enum extends false final finally for if import in int is new null return static String super switch this " +
+			"throw true try var void while with"),
+	},
+	"go": {
+		lineComments: cComments, blockComments: cBlocks, quotes: "\"'`",
+		keywords: words("break case chan const continue default defer else fallthrough for func go goto if import interface " +
+			"map package range return select struct switch type var true false nil iota"),
+	},
+	"hcl": {
+		lineComments: []string{"#", "//"}, blockComments: cBlocks, quotes: `"`,
+		keywords: words("resource data provider variable output module locals terraform true false null"),
+	},
+	"html": {markup: true, quotes: `"'`},
+	"java": {
+		lineComments: cComments, blockComments: cBlocks, quotes: `"'`,
+		keywords: words("abstract boolean break byte case catch char class continue default do double else enum extends " +
+			"false final finally float for if implements import instanceof int interface long new null package private " +
+			"protected public return short static super switch synchronized this throw throws true try void volatile while"),
+	},
+	"javascript": {
+		lineComments: cComments, blockComments: cBlocks, quotes: "\"'`",
+		keywords: words("async await break case catch class const continue default delete do else export extends false " +
+			"finally for function if import in instanceof let new null return super switch this throw true try typeof " +
+			"undefined var void while yield"),
+	},
+	"json": {
+		quotes:   `"`,
+		keywords: words("true false null"),
+	},
+	"kotlin": {
+		lineComments: cComments, blockComments: cBlocks, quotes: `"'`,
+		keywords: words("as break class continue do else false for fun if import in interface is null object override " +
+			"package private public return super this throw true try val var when while"),
+	},
+	"php": {
+		lineComments: []string{"//", "#"}, blockComments: cBlocks, quotes: `"'`,
+		keywords: words("abstract array as break case catch class const continue default do echo else elseif extends false " +
+			"final for foreach function if implements include interface namespace new null private protected public " +
+			"require return static switch this throw true try use while"),
+	},
+	"python": {
+		lineComments: hashComment, quotes: `"'`, tripleQuotes: true,
+		keywords: words("and as assert async await break class continue def del elif else except False finally for from " +
+			"global if import in is lambda None nonlocal not or pass raise return True try while with yield"),
+	},
+	"ruby": {
+		lineComments: hashComment, quotes: `"'`,
+		keywords: words("begin break case class def do else elsif end ensure false for if in module next nil not " +
+			"require rescue retry return self super then true unless until when while yield"),
+	},
+	"rust": {
+		lineComments: cComments, blockComments: cBlocks, quotes: `"`,
+		keywords: words("as break const continue crate else enum extern false fn for if impl in let loop match mod move mut " +
+			"pub ref return self Self static struct super trait true type unsafe use where while"),
+	},
+	"sql": {
+		lineComments: []string{"--"}, blockComments: cBlocks, quotes: `"'`, ignoreCase: true,
+		keywords: words("select from where and or not insert into values update set delete create table drop alter index " +
+			"view join left right inner outer on group by order having limit as distinct null is in like between case " +
+			"when then else end primary key"),
+	},
+	"swift": {
+		lineComments: cComments, blockComments: cBlocks, quotes: `"`,
+		keywords: words("as break case catch class continue default defer do else enum extension false for func guard if " +
+			"import in init let nil private protocol public return self struct switch throw throws true try var where while"),
+	},
+	"typescript": {
+		lineComments: cComments, blockComments: cBlocks, quotes: "\"'`",
+		keywords: words("any async await boolean break case catch class const continue default do else enum export extends " +
+			"false finally for function if implements import in interface let new null number private protected public " +
+			"return string super switch this throw true try type typeof undefined var void while"),
+	},
+	"xml": {markup: true, quotes: `"'`},
+	"yaml": {
+		lineComments: hashComment, quotes: `"'`,
+		keywords: words("true false null yes no"),
+	},
+}
+
+// langAliases maps common alternative names of code languages,
+// such as those of Markdown fenced code blocks, to keys of syntaxes.
+var langAliases = map[string]string{
+	"c++":       "cpp",
+	"cs":        "csharp",
+	"golang":    "go",
+	"js":        "javascript",
+	"jsx":       "javascript",
+	"kt":        "kotlin",
+	"py":        "python",
+	"python3":   "python",
+	"rb":        "ruby",
+	"rs":        "rust",
+	"sh":        "bash",
+	"shell":     "bash",
+	"terraform": "hcl",
+	"tf":        "hcl",
+	"ts":        "typescript",
+	"tsx":       "typescript",
+	"yml":       "yaml",
+	"zsh":       "bash",
+}
+
+// highlight splits code of language lang into tokens.
+// It returns nil if the language is unknown.
+func highlight(lang, code string) []token {
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	if v, ok := langAliases[lang]; ok {
+		lang = v
+	}
+	syn := syntaxes[lang]
+	if syn == nil {
+		return nil
+	}
+	if syn.markup {
+		return syn.lexMarkup(code)
+	}
+	return syn.lex(code)
+}
+
+// lex splits code into tokens of a programming language.
+func (syn *syntax) lex(code string) []token {
+	var toks []token
+	emit := func(k tokenKind, s string) {
+		if n := len(toks); n > 0 && toks[n-1].kind == k && k == tokenText {
+			toks[n-1].text += s
+			return
+		}
+		toks = append(toks, token{k, s})
+	}
+	for i := 0; i < len(code); {
+		s := code[i:]
+		if n := syn.commentLen(s); n > 0 {
+			emit(tokenComment, s[:n])
+			i += n
+			continue
+		}
+		if n := syn.stringLen(s); n > 0 {
+			emit(tokenString, s[:n])
+			i += n
+			continue
+		}
+		c := s[0]
+		prevIdent := i > 0 && isIdentByte(code[i-1])
+		switch {
+		case isDigit(c) && !prevIdent:
+			n := 1
+			for n < len(s) && (isIdentByte(s[n]) || s[n] == '.') {
+				n++
+			}
+			emit(tokenNumber, s[:n])
+			i += n
+		case isIdentByte(c) && !prevIdent:
+			n := 1
+			for n < len(s) && isIdentByte(s[n]) {
+				n++
+			}
+			w := s[:n]
+			if syn.ignoreCase {
+				w = strings.ToLower(w)
+			}
+			if syn.keywords[w] {
+				emit(tokenKeyword, s[:n])
+			} else {
+				emit(tokenText, s[:n])
+			}
+			i += n
+		default:
+			emit(tokenText, s[:1])
+			i++
+		}
+	}
+	return toks
+}
+
+// commentLen returns the length of the comment s starts with, or 0.
+func (syn *syntax) commentLen(s string) int {
+	for _, p := range syn.lineComments {
+		if strings.HasPrefix(s, p) {
+			if n := strings.IndexByte(s, '\n'); n >= 0 {
+				return n
+			}
+			return len(s)
+		}
+	}
+	for _, d := range syn.blockComments {
+		if strings.HasPrefix(s, d[0]) {
+			if n := strings.Index(s[len(d[0]):], d[1]); n >= 0 {
+				return len(d[0]) + n + len(d[1])
+			}
+			return len(s)
+		}
+	}
+	return 0
+}
+
+// stringLen returns the length of the string literal s starts with, or 0.
+// Strings not closed by the end of the line, other than those quoted with a backtick
+// or triple quotes, end there.
+func (syn *syntax) stringLen(s string) int {
+	if s == "" || strings.IndexByte(syn.quotes, s[0]) < 0 {
+		return 0
+	}
+	q := s[0]
+	if syn.tripleQuotes && len(s) >= 3 && s[1] == q && s[2] == q {
+		d := s[:3]
+		if n := strings.Index(s[3:], d); n >= 0 {
+			return 3 + n + 3
+		}
+		return len(s)
+	}
+	for i := 1; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && q != '`':
+			i++
+		case s[i] == q:
+			return i + 1
+		case s[i] == '\n' && q != '`':
+			return i
+		}
+	}
+	return len(s)
+}
+
+// lexMarkup splits HTML or XML code into tokens: comments, tag names
+// and attribute values.
+func (syn *syntax) lexMarkup(code string) []token {
+	var toks []token
+	emit := func(k tokenKind, s string) {
+		if n := len(toks); n > 0 && toks[n-1].kind == k && k == tokenText {
+			toks[n-1].text += s
+			return
+		}
+		toks = append(toks, token{k, s})
+	}
+	inTag := false
+	for i := 0; i < len(code); {
+		s := code[i:]
+		switch {
+		case !inTag && strings.HasPrefix(s, "<!--"):
+			n := strings.Index(s, "-->")
+			if n < 0 {
+				n = len(s)
+			} else {
+				n += len("-->")
+			}
+			emit(tokenComment, s[:n])
+			i += n
+		case !inTag && markupTagLen(s) > 0:
+			n := 1
+			for strings.IndexByte("/?!", s[n]) >= 0 {
+				n++
+			}
+			m := markupTagLen(s)
+			emit(tokenText, s[:n])
+			emit(tokenKeyword, s[n:m])
+			inTag = true
+			i += m
+		case inTag && s[0] == '>':
+			emit(tokenText, s[:1])
+			inTag = false
+			i++
+		case inTag && syn.stringLen(s) > 0:
+			n := syn.stringLen(s)
+			emit(tokenString, s[:n])
+			i += n
+		default:
+			emit(tokenText, s[:1])
+			i++
+		}
+	}
+	return toks
+}
+
+// markupTagLen returns the length of the start of a tag s starts with,
+// made of "<", an optional "/", "?" or "!" and the tag name, or 0.
+func markupTagLen(s string) int {
+	if s == "" || s[0] != '<' {
+		return 0
+	}
+	n := 1
+	for n < len(s) && strings.IndexByte("/?!", s[n]) >= 0 {
+		n++
+	}
+	m := n
+	for m < len(s) && (isIdentByte(s[m]) || s[m] == '-' || s[m] == ':') {
+		m++
+	}
+	if m == n {
+		return 0
+	}
+	return m
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+// isIdentByte reports whether c may be part of an identifier.
+// Bytes of non-ASCII characters are considered identifier bytes.
+func isIdentByte(c byte) bool {
+	return c == '_' || c == '$' || isDigit(c) || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || c >= 0x80
+}
@@ -0,0 +1,135 @@
+// Copyright 2018 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/CloudVLab/tools/claat/types"
+)
+
+func TestHighlight(t *testing.T) {
+	tests := []struct {
+		lang, code string
+		toks       []token
+	}{
+		{"go", "func f() int { return 42 } // answer", []token{
+			{tokenKeyword, "func"}, {tokenText, " f() int { "},
+			{tokenKeyword, "return"}, {tokenText, " "}, {tokenNumber, "42"}, {tokenText, " } "},
+			{tokenComment, "// answer"},
+		}},
+		{"Python", "s = '''a\nb'''\nx2 = \"it's\" # c", []token{
+			{tokenText, "s = "}, {tokenString, "'''a\nb'''"}, {tokenText, "\nx2 = "},
+			{tokenString, `"it's"`}, {tokenText, " "}, {tokenComment, "# c"},
+		}},
+		{"sql", "SELECT 'a\nFROM t", []token{
+			{tokenKeyword, "SELECT"}, {tokenText, " "}, {tokenString, "'a"}, {tokenText, "\n"},
+			{tokenKeyword, "FROM"}, {tokenText, " t"},
+		}},
+		{"html", `<!-- c --><a href="/x">1 < 2</a>`, []token{
+			{tokenComment, "<!-- c -->"}, {tokenText, "<"}, {tokenKeyword, "a"}, {tokenText, " href="},
+			{tokenString, `"/x"`}, {tokenText, ">1 < 2</"}, {tokenKeyword, "a"}, {tokenText, ">"},
+		}},
+		{"unknown", "x := 1", nil},
+		// aliases
+		{"js", "let x", []token{{tokenKeyword, "let"}, {tokenText, " x"}}},
+		{"TS", "type T", []token{{tokenKeyword, "type"}, {tokenText, " T"}}},
+		{"shell", "echo hi", []token{{tokenKeyword, "echo"}, {tokenText, " hi"}}},
+		{"py", "pass", []token{{tokenKeyword, "pass"}}},
+		{"yml", "a: true", []token{{tokenText, "a: "}, {tokenKeyword, "true"}}},
+	}
+	for _, tc := range tests {
+		toks := highlight(tc.lang, tc.code)
+		if !reflect.DeepEqual(toks, tc.toks) {
+			t.Errorf("highlight(%q, %q) =\n%v\nwant:\n%v", tc.lang, tc.code, toks, tc.toks)
+		}
+	}
+}
+
+func TestHighlightCode(t *testing.T) {
+	theme, ok := LookupTheme("light")
+	if !ok {
+		t.Fatal("no light theme")
+	}
+	code := types.NewCodeNode("x := \"<a>\"", false)
+	code.Lang = "go"
+	term := types.NewCodeNode("ls", true)
+	plain := types.NewCodeNode("x", false)
+
+	var buf bytes.Buffer
+	hw := htmlWriter{w: &buf, theme: theme}
+	hw.write(code, term, plain)
+	want := `<pre style="background-color: #f6f8fa; color: #24292e"><code language="go" class="go">` +
+		`x := <span style="color: #032f62">&#34;&lt;a&gt;&#34;</span></code></pre>` + "\n" +
+		`<pre>ls</pre>` + "\n" +
+		`<pre style="background-color: #f6f8fa; color: #24292e"><code>x</code></pre>` + "\n"
+	if v := buf.String(); v != want {
+		t.Errorf("html:\n%s\nwant:\n%s", v, want)
+	}
+
+	buf.Reset()
+	lw := liteWriter{w: &buf, theme: theme}
+	lw.write(code, term, plain)
+	want = `<pre style="background-color: #f6f8fa; color: #24292e"><code language="go" class="go">` +
+		`x := <span style="color: #032f62">&#34;&lt;a&gt;&#34;</span></code></pre>` +
+		`<pre>ls</pre>` +
+		`<pre style="background-color: #f6f8fa; color: #24292e"><code>x</code></pre>`
+	if v := buf.String(); v != want {
+		t.Errorf("lite:\n%s\nwant:\n%s", v, want)
+	}
+
+	// no highlighting by default
+	buf.Reset()
+	WriteHTML(&buf, "", code)
+	if v := buf.String(); strings.Contains(v, "style") {
+		t.Errorf("WriteHTML = %s; want no highlighting", v)
+	}
+}
+
+func TestExecuteHighlight(t *testing.T) {
+	code := types.NewCodeNode("return", false)
+	code.Lang = "go"
+	step := &types.Step{Title: "Code", Content: types.NewListNode(code)}
+	ctx := &Context{
+		Meta:  &types.Meta{},
+		Steps: []*types.Step{step},
+	}
+	theme, _ := LookupTheme("dark")
+	var buf bytes.Buffer
+	if err := Execute(&buf, "html", ctx, WithHighlight(theme)); err != nil {
+		t.Fatal(err)
+	}
+	want := `<span style="color: #f92672">return</span>`
+	if !strings.Contains(buf.String(), want) {
+		t.Errorf("Execute output does not contain %s", want)
+	}
+}
+
+func TestHighlightEscape(t *testing.T) {
+	theme := &Theme{Background: `"><script>`, Keyword: `red" onclick="x`}
+	code := types.NewCodeNode("return", false)
+	code.Lang = "go"
+	var buf bytes.Buffer
+	hw := htmlWriter{w: &buf, theme: theme}
+	hw.write(code)
+	want := `<pre style="background-color: &#34;&gt;&lt;script&gt;; color: "><code language="go" class="go">` +
+		`<span style="color: red&#34; onclick=&#34;x">return</span></code></pre>` + "\n"
+	if v := buf.String(); v != want {
+		t.Errorf("html:\n%s\nwant:\n%s", v, want)
+	}
+}
@@ -17,6 +17,7 @@ package render
 import (
 	"bytes"
 	"fmt"
+	"html"
 	htmlTemplate "html/template"
 	"io"
 	"sort"
@@ -51,9 +52,10 @@ func WriteHTML(w io.Writer, env string, nodes ...types.Node) error {
 }
 
 type htmlWriter struct {
-	w   io.Writer // output writer
-	env string    // target environment
-	err error     // error during any writeXxx methods
+	w     io.Writer // output writer
+	env   string    // target environment
+	theme *Theme    // theme of code highlighted server-side, or nil
+	err   error     // error during any writeXxx methods
 }
 
 func (hw *htmlWriter) matchEnv(v []string) bool {
@@ -136,12 +138,27 @@ func (hw *htmlWriter) writeEscape(s string) {
 }
 
 func (hw *htmlWriter) text(n *types.TextNode) {
+	if n.Role != "" {
+		hw.writeFmt(`<span class="%s">`, n.Role)
+	}
 	if n.Bold {
 		hw.writeString("<strong>")
 	}
 	if n.Italic {
 		hw.writeString("<em>")
 	}
+	if n.Strikethrough {
+		hw.writeString("<s>")
+	}
+	if n.Underline {
+		hw.writeString("<u>")
+	}
+	if n.Superscript {
+		hw.writeString("<sup>")
+	}
+	if n.Subscript {
+		hw.writeString("<sub>")
+	}
 	if n.Code {
 		hw.writeString("<code>")
 	}
@@ -150,23 +167,89 @@ func (hw *htmlWriter) text(n *types.TextNode) {
 	if n.Code {
 		hw.writeString("</code>")
 	}
+	if n.Subscript {
+		hw.writeString("</sub>")
+	}
+	if n.Superscript {
+		hw.writeString("</sup>")
+	}
+	if n.Underline {
+		hw.writeString("</u>")
+	}
+	if n.Strikethrough {
+		hw.writeString("</s>")
+	}
 	if n.Italic {
 		hw.writeString("</em>")
 	}
 	if n.Bold {
 		hw.writeString("</strong>")
 	}
+	if n.Role != "" {
+		hw.writeString("</span>")
+	}
 }
 
 func (hw *htmlWriter) image(n *types.ImageNode) {
+	if n.Caption != "" {
+		hw.writeString("<figure>")
+	}
 	hw.writeString("<img")
-	if n.MaxWidth > 0 {
-		hw.writeFmt(` style="max-width: %.2fpx"`, n.MaxWidth)
+	if s := imageStyle(n); s != "" {
+		hw.writeFmt(` style="%s"`, s)
+	}
+	hw.writeString(` alt="`)
+	hw.writeEscape(n.Alt)
+	hw.writeBytes(doubleQuote)
+	if n.Title != "" {
+		hw.writeString(` title="`)
+		hw.writeEscape(n.Title)
+		hw.writeBytes(doubleQuote)
 	}
 	hw.writeString(` src="`)
 	hw.writeString(n.Src)
 	hw.writeBytes(doubleQuote)
 	hw.writeBytes(greaterThan)
+	if n.Caption != "" {
+		hw.writeString("<figcaption>")
+		hw.writeEscape(n.Caption)
+		hw.writeString("</figcaption></figure>")
+	}
+}
+
+// imageStyle returns the inline CSS of image n, which keeps its size limits and alignment.
+// Images which are part of a line of text are aligned with the text around them.
+func imageStyle(n *types.ImageNode) string {
+	var s []string
+	if n.MaxWidth > 0 {
+		s = append(s, fmt.Sprintf("max-width: %.2fpx", n.MaxWidth))
+	}
+	if n.MaxHeight > 0 {
+		s = append(s, fmt.Sprintf("max-height: %.2fpx", n.MaxHeight))
+	}
+	switch n.Align {
+	case types.ImageAlignLeft, types.ImageAlignRight:
+		s = append(s, "float: "+string(n.Align))
+	case types.ImageAlignCenter:
+		s = append(s, "display: block", "margin: 0 auto")
+	default:
+		if n.Inline {
+			s = append(s, "display: inline", "vertical-align: middle")
+		}
+	}
+	return strings.Join(s, "; ")
+}
+
+// imageTag returns the <img> markup of image n, without its caption.
+// All attribute values are escaped, so the markup can be embedded in Markdown.
+func imageTag(n *types.ImageNode) string {
+	var buf bytes.Buffer
+	hw := htmlWriter{w: &buf}
+	img := *n
+	img.Src = html.EscapeString(n.Src)
+	img.Caption = ""
+	hw.image(&img)
+	return buf.String()
 }
 
 func (hw *htmlWriter) url(n *types.URLNode) {
@@ -208,7 +291,12 @@ func (hw *htmlWriter) button(n *types.ButtonNode) {
 }
 
 func (hw *htmlWriter) code(n *types.CodeNode) {
-	hw.writeString("<pre>")
+	hl := hw.theme != nil && !n.Term
+	if hl {
+		hw.writeFmt(`<pre style="%s">`, html.EscapeString(hw.theme.preStyle()))
+	} else {
+		hw.writeString("<pre>")
+	}
 	if !n.Term {
 		hw.writeString("<code")
 		if n.Lang != "" {
@@ -216,7 +304,23 @@ func (hw *htmlWriter) code(n *types.CodeNode) {
 		}
 		hw.writeBytes(greaterThan)
 	}
-	hw.writeEscape(n.Value)
+	var toks []token
+	if hl {
+		toks = highlight(n.Lang, n.Value)
+	}
+	if toks == nil {
+		hw.writeEscape(n.Value)
+	}
+	for _, t := range toks {
+		s := hw.theme.tokenStyle(t.kind)
+		if s == "" {
+			hw.writeEscape(t.text)
+			continue
+		}
+		hw.writeFmt(`<span style="%s">`, html.EscapeString(s))
+		hw.writeEscape(t.text)
+		hw.writeString("</span>")
+	}
 	if !n.Term {
 		hw.writeString("</code>")
 	}
@@ -224,7 +328,7 @@ func (hw *htmlWriter) code(n *types.CodeNode) {
 }
 
 func (hw *htmlWriter) list(n *types.ListNode) {
-	wrap := n.Block() == true
+	wrap := n.Block() == true && figure(n) == nil
 	if wrap {
 		hw.writeString("<p>")
 	}
@@ -234,6 +338,19 @@ func (hw *htmlWriter) list(n *types.ListNode) {
 	}
 }
 
+// figure returns the captioned image which is the only content of n, if any.
+// A paragraph made of such an image is rendered as a figure, which cannot be nested in <p>.
+func figure(n *types.ListNode) *types.ImageNode {
+	if len(n.Nodes) != 1 {
+		return nil
+	}
+	img, ok := n.Nodes[0].(*types.ImageNode)
+	if !ok || img.Caption == "" {
+		return nil
+	}
+	return img
+}
+
 func (hw *htmlWriter) itemsList(n *types.ItemsListNode) {
 	tag := "ul"
 	if n.Type() == types.NodeItemsList && n.Start > 0 {
@@ -275,9 +392,13 @@ func (hw *htmlWriter) grid(n *types.GridNode) {
 	for _, r := range n.Rows {
 		hw.writeString("<tr>")
 		for _, c := range r {
-			hw.writeFmt(`<td colspan="%d" rowspan="%d">`, c.Colspan, c.Rowspan)
+			tag := "td"
+			if c.Header {
+				tag = "th"
+			}
+			hw.writeFmt(`<%s colspan="%d" rowspan="%d">`, tag, c.Colspan, c.Rowspan)
 			hw.write(c.Content.Nodes...)
-			hw.writeString("</td>")
+			hw.writeFmt("</%s>", tag)
 		}
 		hw.writeString("</tr>\n")
 	}
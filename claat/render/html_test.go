@@ -15,6 +15,7 @@
 package render
 
 import (
+	htmlTemplate "html/template"
 	"testing"
 
 	"github.com/CloudVLab/tools/claat/types"
@@ -49,3 +50,118 @@ func TestHTMLEnv(t *testing.T) {
 		}
 	}
 }
+
+func TestHTMLImage(t *testing.T) {
+	img := types.NewImageNode("shell.png")
+	img.Alt = `Cloud "Shell"`
+	img.Title = "Activate"
+	plain := types.NewImageNode("plain.png")
+	fig := types.NewImageNode("shell.png")
+	fig.Alt = "Cloud Shell"
+	fig.Caption = "The <Cloud Shell> button"
+	para := types.NewListNode(fig)
+	para.MutateBlock(true)
+	icon := types.NewImageNode("run.png")
+	icon.MaxWidth = 16
+	icon.MaxHeight = 16
+	icon.Inline = true
+	centered := types.NewImageNode("diagram.png")
+	centered.Align = types.ImageAlignCenter
+
+	tests := []struct {
+		nodes  []types.Node
+		output map[string]string // renderer name to output
+	}{
+		{
+			[]types.Node{img},
+			map[string]string{
+				"html":          `<img alt="Cloud &#34;Shell&#34;" title="Activate" src="shell.png">`,
+				"lite":          `<img src="shell.png" alt="Cloud &#34;Shell&#34;" title="Activate"/>`,
+				"qwiklabs-html": `<img alt="Cloud &#34;Shell&#34;" title="Activate" src="shell.png">`,
+			},
+		},
+		{
+			[]types.Node{plain},
+			map[string]string{
+				"html":          `<img alt="" src="plain.png">`,
+				"lite":          `<img src="plain.png" alt=""/>`,
+				"qwiklabs-html": `<img alt="" src="plain.png">`,
+			},
+		},
+		{
+			[]types.Node{para},
+			map[string]string{
+				"html":          "<figure><img alt=\"Cloud Shell\" src=\"shell.png\"><figcaption>The &lt;Cloud Shell&gt; button</figcaption></figure>\n",
+				"lite":          `<figure><img src="shell.png" alt="Cloud Shell"/><figcaption>The &lt;Cloud Shell&gt; button</figcaption></figure>`,
+				"qwiklabs-html": "<figure><img alt=\"Cloud Shell\" src=\"shell.png\"><figcaption>The &lt;Cloud Shell&gt; button</figcaption></figure>\n",
+			},
+		},
+		{
+			[]types.Node{icon},
+			map[string]string{
+				"html":          `<img style="max-width: 16.00px; max-height: 16.00px; display: inline; vertical-align: middle" alt="" src="run.png">`,
+				"lite":          `<img src="run.png" alt="" style="max-width: 16.00px; max-height: 16.00px; display: inline; vertical-align: middle"/>`,
+				"qwiklabs-html": `<img style="max-width: 16.00px; max-height: 16.00px; display: inline; vertical-align: middle" alt="" src="run.png">`,
+			},
+		},
+		{
+			[]types.Node{centered},
+			map[string]string{
+				"html":          `<img style="display: block; margin: 0 auto" alt="" src="diagram.png">`,
+				"lite":          `<img src="diagram.png" alt="" style="display: block; margin: 0 auto"/>`,
+				"qwiklabs-html": `<img style="display: block; margin: 0 auto" alt="" src="diagram.png">`,
+			},
+		},
+	}
+	renderers := map[string]func(string, ...types.Node) (htmlTemplate.HTML, error){
+		"html":          HTML,
+		"lite":          Lite,
+		"qwiklabs-html": QwiklabsHTML,
+	}
+	for i, tc := range tests {
+		for name, render := range renderers {
+			h, err := render("", tc.nodes...)
+			if err != nil {
+				t.Errorf("%d: %s: %v", i, name, err)
+				continue
+			}
+			if v := string(h); v != tc.output[name] {
+				t.Errorf("%d: %s: v = %q; want %q", i, name, v, tc.output[name])
+			}
+		}
+	}
+}
+
+func TestHTMLTextStyles(t *testing.T) {
+	strike := types.NewTextNode("v1")
+	strike.Strikethrough = true
+	under := types.NewTextNode("note")
+	under.Underline = true
+	sup := types.NewTextNode("2")
+	sup.Superscript = true
+	sub := types.NewTextNode("2")
+	sub.Subscript = true
+	sub.Bold = true
+	ph := types.NewTextNode("PROJECT_ID")
+	ph.Role = types.TextPlaceholder
+	ph.Code = true
+	nodes := []types.Node{strike, under, sup, sub, ph}
+
+	for name, test := range map[string]struct {
+		render func(string, ...types.Node) (htmlTemplate.HTML, error)
+		output string
+	}{
+		"html":          {HTML, `<s>v1</s><u>note</u><sup>2</sup><strong><sub>2</sub></strong><span class="placeholder"><code>PROJECT_ID</code></span>`},
+		"lite":          {Lite, `<s>v1</s><u>note</u><sup>2</sup><sub><strong>2</strong></sub><span class="placeholder"><code>PROJECT_ID</code></span>`},
+		"qwiklabs-html": {QwiklabsHTML, `<s>v1</s><u>note</u><sup>2</sup><strong><sub>2</sub></strong><span class="placeholder"><code>PROJECT_ID</code></span>`},
+	} {
+		h, err := test.render("", nodes...)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if v := string(h); v != test.output {
+			t.Errorf("%s: v = %q; want %q", name, v, test.output)
+		}
+	}
+}
@@ -45,9 +45,10 @@ func WriteLite(w io.Writer, env string, nodes ...types.Node) error {
 }
 
 type liteWriter struct {
-	w   io.Writer // output writer
-	env string    // target environment
-	err error     // error during any writeXxx methods
+	w     io.Writer // output writer
+	env   string    // target environment
+	theme *Theme    // theme of code highlighted server-side, or nil
+	err   error     // error during any writeXxx methods
 }
 
 func (lw *liteWriter) matchEnv(v []string) bool {
@@ -118,11 +119,40 @@ func (lw *liteWriter) text(n *types.TextNode) *html.Node {
 		hn.AppendChild(top)
 		top = hn
 	}
+	if n.Subscript {
+		hn := &html.Node{Type: html.ElementNode, Data: atom.Sub.String()}
+		hn.AppendChild(top)
+		top = hn
+	}
+	if n.Superscript {
+		hn := &html.Node{Type: html.ElementNode, Data: atom.Sup.String()}
+		hn.AppendChild(top)
+		top = hn
+	}
+	if n.Underline {
+		hn := &html.Node{Type: html.ElementNode, Data: atom.U.String()}
+		hn.AppendChild(top)
+		top = hn
+	}
+	if n.Strikethrough {
+		hn := &html.Node{Type: html.ElementNode, Data: atom.S.String()}
+		hn.AppendChild(top)
+		top = hn
+	}
 	if n.Code {
 		hn := &html.Node{Type: html.ElementNode, Data: atom.Code.String()}
 		hn.AppendChild(top)
 		top = hn
 	}
+	if n.Role != "" {
+		hn := &html.Node{
+			Type: html.ElementNode,
+			Data: atom.Span.String(),
+			Attr: []html.Attribute{{Key: "class", Val: string(n.Role)}},
+		}
+		hn.AppendChild(top)
+		top = hn
+	}
 	return top
 }
 
@@ -130,15 +160,23 @@ func (lw *liteWriter) image(n *types.ImageNode) *html.Node {
 	hn := &html.Node{
 		Type: html.ElementNode,
 		Data: atom.Img.String(),
-		Attr: []html.Attribute{{Key: "src", Val: n.Src}},
+		Attr: []html.Attribute{{Key: "src", Val: n.Src}, {Key: "alt", Val: n.Alt}},
 	}
-	if n.MaxWidth > 0 {
-		hn.Attr = append(hn.Attr, html.Attribute{
-			Key: "style",
-			Val: fmt.Sprintf("max-width: %.2fpx", n.MaxWidth),
-		})
+	if n.Title != "" {
+		hn.Attr = append(hn.Attr, html.Attribute{Key: "title", Val: n.Title})
 	}
-	return hn
+	if s := imageStyle(n); s != "" {
+		hn.Attr = append(hn.Attr, html.Attribute{Key: "style", Val: s})
+	}
+	if n.Caption == "" {
+		return hn
+	}
+	top := &html.Node{Type: html.ElementNode, Data: atom.Figure.String()}
+	top.AppendChild(hn)
+	caption := &html.Node{Type: html.ElementNode, Data: atom.Figcaption.String()}
+	caption.AppendChild(&html.Node{Type: html.TextNode, Data: n.Caption})
+	top.AppendChild(caption)
+	return top
 }
 
 func (lw *liteWriter) alink(n *types.URLNode) *html.Node {
@@ -185,8 +223,34 @@ func (lw *liteWriter) button(n *types.ButtonNode) *html.Node {
 }
 
 func (lw *liteWriter) code(n *types.CodeNode) *html.Node {
-	top := &html.Node{Type: html.TextNode, Data: n.Value}
+	hl := lw.theme != nil && !n.Term
+	var toks []token
+	if hl {
+		toks = highlight(n.Lang, n.Value)
+	}
+	var content []*html.Node
+	if toks == nil {
+		content = append(content, &html.Node{Type: html.TextNode, Data: n.Value})
+	}
+	for _, t := range toks {
+		tn := &html.Node{Type: html.TextNode, Data: t.text}
+		if s := lw.theme.tokenStyle(t.kind); s != "" {
+			span := &html.Node{
+				Type: html.ElementNode,
+				Data: atom.Span.String(),
+				Attr: []html.Attribute{{Key: "style", Val: s}},
+			}
+			span.AppendChild(tn)
+			tn = span
+		}
+		content = append(content, tn)
+	}
 
+	top := &html.Node{Type: html.ElementNode, Data: atom.Pre.String()}
+	if hl {
+		top.Attr = append(top.Attr, html.Attribute{Key: "style", Val: lw.theme.preStyle()})
+	}
+	parent := top
 	if !n.Term {
 		hn := &html.Node{Type: html.ElementNode, Data: atom.Code.String()}
 		if n.Lang != "" {
@@ -199,18 +263,19 @@ func (lw *liteWriter) code(n *types.CodeNode) *html.Node {
 				Val: n.Lang,
 			})
 		}
-		hn.AppendChild(top)
-		top = hn
+		top.AppendChild(hn)
+		parent = hn
+	}
+	for _, cn := range content {
+		parent.AppendChild(cn)
 	}
-
-	hn := &html.Node{Type: html.ElementNode, Data: atom.Pre.String()}
-	hn.AppendChild(top)
-	top = hn
-
 	return top
 }
 
 func (lw *liteWriter) list(n *types.ListNode) *html.Node {
+	if img := figure(n); img != nil {
+		return lw.image(img)
+	}
 	a := atom.P
 	if n.Block() != true {
 		a = atom.Div
@@ -278,9 +343,13 @@ func (lw *liteWriter) grid(n *types.GridNode) *html.Node {
 	for _, r := range n.Rows {
 		tr := &html.Node{Type: html.ElementNode, Data: atom.Tr.String()}
 		for _, c := range r {
+			a := atom.Td
+			if c.Header {
+				a = atom.Th
+			}
 			td := &html.Node{
 				Type: html.ElementNode,
-				Data: atom.Td.String(),
+				Data: a.String(),
 				Attr: []html.Attribute{
 					{Key: "colspan", Val: strconv.Itoa(c.Colspan)},
 					{Key: "rowspan", Val: strconv.Itoa(c.Rowspan)},
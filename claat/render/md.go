@@ -17,7 +17,6 @@ package render
 import (
 	"bytes"
 	"io"
-	"path"
 	"sort"
 	"strconv"
 	"strings"
@@ -25,6 +24,13 @@ import (
 	"github.com/CloudVLab/tools/claat/types"
 )
 
+var (
+	// mdAltEscaper escapes image alt text in markdown.
+	mdAltEscaper = strings.NewReplacer("[", `\[`, "]", `\]`)
+	// mdTitleEscaper escapes image titles in markdown.
+	mdTitleEscaper = strings.NewReplacer(`"`, `\"`)
+)
+
 // MD renders nodes as markdown for the target env.
 func MD(env string, nodes ...types.Node) (string, error) {
 	var buf bytes.Buffer
@@ -45,6 +51,7 @@ type mdWriter struct {
 	env       string    // target environment
 	err       error     // error during any writeXxx methods
 	lineStart bool
+	listDepth int // nesting level of the items list being written
 }
 
 func (mw *mdWriter) writeBytes(b []byte) {
@@ -124,12 +131,27 @@ func (mw *mdWriter) write(nodes ...types.Node) error {
 }
 
 func (mw *mdWriter) text(n *types.TextNode) {
+	if n.Role != "" {
+		mw.writeString("[")
+	}
 	if n.Bold {
 		mw.writeString("__")
 	}
 	if n.Italic {
 		mw.writeString(" *")
 	}
+	if n.Strikethrough {
+		mw.writeString("~~")
+	}
+	if n.Underline {
+		mw.writeString("<u>")
+	}
+	if n.Superscript {
+		mw.writeString("<sup>")
+	}
+	if n.Subscript {
+		mw.writeString("<sub>")
+	}
 	if n.Code {
 		mw.writeString("`")
 	}
@@ -137,21 +159,46 @@ func (mw *mdWriter) text(n *types.TextNode) {
 	if n.Code {
 		mw.writeString("`")
 	}
+	if n.Subscript {
+		mw.writeString("</sub>")
+	}
+	if n.Superscript {
+		mw.writeString("</sup>")
+	}
+	if n.Underline {
+		mw.writeString("</u>")
+	}
+	if n.Strikethrough {
+		mw.writeString("~~")
+	}
 	if n.Italic {
 		mw.writeString("* ")
 	}
 	if n.Bold {
 		mw.writeString("__")
 	}
+	if n.Role != "" {
+		mw.writeString("]{." + string(n.Role) + "}")
+	}
 }
 
 func (mw *mdWriter) image(n *types.ImageNode) {
 	mw.space()
 	mw.writeString("![")
-	mw.writeString(path.Base(n.Src))
+	mw.writeString(mdAltEscaper.Replace(n.Alt))
 	mw.writeString("](")
 	mw.writeString(n.Src)
+	if n.Title != "" {
+		mw.writeString(` "`)
+		mw.writeString(mdTitleEscaper.Replace(n.Title))
+		mw.writeString(`"`)
+	}
 	mw.writeString(")")
+	if n.Caption != "" {
+		mw.writeString("\n*")
+		mw.writeString(n.Caption)
+		mw.writeString("*")
+	}
 }
 
 func (mw *mdWriter) url(n *types.URLNode) {
@@ -209,20 +256,43 @@ func (mw *mdWriter) list(n *types.ListNode) {
 }
 
 func (mw *mdWriter) itemsList(n *types.ItemsListNode) {
-	mw.newBlock()
+	// Nested lists start right on the next line of the parent item.
+	if mw.listDepth == 0 {
+		mw.newBlock()
+	} else if !mw.lineStart {
+		mw.writeBytes(newLine)
+	}
 	for i, item := range n.Items {
 		s := "* "
 		if n.Type() == types.NodeItemsList && n.Start > 0 {
 			s = strconv.Itoa(i+n.Start) + ". "
 		}
-		mw.writeString(s)
-		mw.write(item.Nodes...)
+		var buf bytes.Buffer
+		iw := &mdWriter{w: &buf, env: mw.env, lineStart: true, listDepth: mw.listDepth + 1}
+		if err := iw.write(item.Nodes...); err != nil {
+			mw.err = err
+			return
+		}
+		mw.writeString(s + indentItem(buf.String()))
 		if !mw.lineStart {
 			mw.writeBytes(newLine)
 		}
 	}
 }
 
+// indentItem formats s, the markdown content of a list item, to follow the item marker.
+// Blank lines at the start of s are dropped, and the following lines are indented,
+// so that blocks such as code or nested lists remain part of the item.
+func indentItem(s string) string {
+	lines := strings.Split(strings.TrimLeft(s, "\n"), "\n")
+	for i := 1; i < len(lines); i++ {
+		if lines[i] != "" {
+			lines[i] = "    " + lines[i]
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
 func (mw *mdWriter) header(n *types.HeaderNode) {
 	mw.newBlock()
 	mw.writeString(strings.Repeat("#", n.Level+1))
@@ -0,0 +1,200 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/CloudVLab/tools/claat/types"
+)
+
+func TestMDNestedList(t *testing.T) {
+	nested := types.NewItemsListNode("", 0)
+	nested.NewItem(types.NewTextNode("nested"))
+	list := types.NewItemsListNode("", 1)
+	list.NewItem(types.NewTextNode("one"), nested)
+	list.NewItem(types.NewTextNode("two"))
+
+	want := "\n\n1. one\n    * nested\n2. two\n"
+	for name, render := range map[string]func(string, ...types.Node) (string, error){
+		"md":              MD,
+		"qwiklabs-md":     QwiklabsMD,
+		"qwiklabs-git-md": QwiklabsGitMD,
+	} {
+		v, err := render("", list)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if v != want {
+			t.Errorf("%s: v = %q; want %q", name, v, want)
+		}
+	}
+}
+
+func TestMDImage(t *testing.T) {
+	img := types.NewImageNode("img/shell.png")
+	img.Alt = "Cloud [Shell]"
+	img.Title = `The "Activate" button`
+	fig := types.NewImageNode("img/shell.png")
+	fig.Caption = "Cloud Shell"
+	icon := types.NewImageNode("img/run.png")
+	icon.Alt = "Run"
+	icon.MaxHeight = 16
+	icon.Inline = true
+	// size of an image exported from docs
+	shot := types.NewImageNode("img/shell.png")
+	shot.MaxWidth = 624
+	sized := types.NewImageNode("img/a&b.png")
+	sized.MaxWidth = 300
+	sized.Sized = true
+
+	tests := []struct {
+		node   types.Node
+		output map[string]string // renderer name to output
+	}{
+		{
+			img,
+			map[string]string{
+				"md":              `![Cloud \[Shell\]](img/shell.png "The \"Activate\" button")`,
+				"qwiklabs-md":     `![Cloud \[Shell\]](img/shell.png "The \"Activate\" button")`,
+				"qwiklabs-git-md": `![Cloud \[Shell\]](img/shell.png "The \"Activate\" button")`,
+			},
+		},
+		{
+			fig,
+			map[string]string{
+				"md":              "![](img/shell.png)\n*Cloud Shell*",
+				"qwiklabs-md":     "![](img/shell.png)\n*Cloud Shell*",
+				"qwiklabs-git-md": "![](img/shell.png)\n*Cloud Shell*",
+			},
+		},
+		// inline images and author sizes need HTML, except for plain markdown
+		{
+			icon,
+			map[string]string{
+				"md":              `![Run](img/run.png)`,
+				"qwiklabs-md":     `<img style="max-height: 16.00px; display: inline; vertical-align: middle" alt="Run" src="img/run.png">`,
+				"qwiklabs-git-md": `<img style="max-height: 16.00px; display: inline; vertical-align: middle" alt="Run" src="img/run.png">`,
+			},
+		},
+		{
+			shot,
+			map[string]string{
+				"md":              `![](img/shell.png)`,
+				"qwiklabs-md":     `![](img/shell.png)`,
+				"qwiklabs-git-md": `![](img/shell.png)`,
+			},
+		},
+		{
+			sized,
+			map[string]string{
+				"md":              `![](img/a&b.png)`,
+				"qwiklabs-md":     `<img style="max-width: 300.00px" alt="" src="img/a&amp;b.png">`,
+				"qwiklabs-git-md": `<img style="max-width: 300.00px" alt="" src="img/a&amp;b.png">`,
+			},
+		},
+	}
+	renderers := map[string]func(string, ...types.Node) (string, error){
+		"md":              MD,
+		"qwiklabs-md":     QwiklabsMD,
+		"qwiklabs-git-md": QwiklabsGitMD,
+	}
+	for i, tc := range tests {
+		for name, render := range renderers {
+			v, err := render("", tc.node)
+			if err != nil {
+				t.Errorf("%d: %s: %v", i, name, err)
+				continue
+			}
+			// writers start inline content with a space separator
+			if v = strings.TrimPrefix(v, " "); v != tc.output[name] {
+				t.Errorf("%d: %s: v = %q; want %q", i, name, v, tc.output[name])
+			}
+		}
+	}
+}
+
+func TestMDTextStyles(t *testing.T) {
+	strike := types.NewTextNode("v1")
+	strike.Strikethrough = true
+	under := types.NewTextNode("note")
+	under.Underline = true
+	sup := types.NewTextNode("2")
+	sup.Superscript = true
+	sub := types.NewTextNode("2")
+	sub.Subscript = true
+	ui := types.NewTextNode("Save")
+	ui.Role = types.TextUI
+	ui.Bold = true
+
+	const styles = "~~v1~~<u>note</u><sup>2</sup><sub>2</sub>"
+	// only claat reads the role attribute syntax back
+	outputs := map[string]string{
+		"md":              styles + "[__Save__]{.ui}",
+		"qwiklabs-md":     styles + `<span class="ui">__Save__</span>`,
+		"qwiklabs-git-md": styles + `<span class="ui">__Save__</span>`,
+	}
+	for name, render := range map[string]func(string, ...types.Node) (string, error){
+		"md":              MD,
+		"qwiklabs-md":     QwiklabsMD,
+		"qwiklabs-git-md": QwiklabsGitMD,
+	} {
+		v, err := render("", strike, under, sup, sub, ui)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if want := outputs[name]; v != want {
+			t.Errorf("%s: v = %q; want %q", name, v, want)
+		}
+	}
+}
+
+func TestMDLooseList(t *testing.T) {
+	text := types.NewListNode(types.NewTextNode("Run the app:"))
+	code := types.NewCodeNode("go run .\n", false)
+	code.Lang = "bash"
+	code.MutateBlock(true)
+	para := types.NewListNode(types.NewTextNode("It prints hello."))
+	para.MutateBlock(true)
+	list := types.NewItemsListNode("", 1)
+	list.NewItem(text, code, para)
+	list.NewItem(types.NewTextNode("Stop it."))
+
+	// blocks following the item text are indented to remain part of the item
+	block := "    ```bash\n    go run .\n    ```\n\n    It prints hello.\n2. Stop it.\n"
+	tests := map[string]string{
+		"md":              "\n\n1. Run the app:\n\n" + block,
+		"qwiklabs-md":     "\n\n1. Run the app:\n\n\n" + block,
+		"qwiklabs-git-md": "\n\n1. Run the app:\n\n" + block,
+	}
+	renderers := map[string]func(string, ...types.Node) (string, error){
+		"md":              MD,
+		"qwiklabs-md":     QwiklabsMD,
+		"qwiklabs-git-md": QwiklabsGitMD,
+	}
+	for name, render := range renderers {
+		v, err := render("", list)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if v != tests[name] {
+			t.Errorf("%s: v = %q; want %q", name, v, tests[name])
+		}
+	}
+}
@@ -18,7 +18,6 @@ import (
 	"bytes"
 	"fmt"
 	"io"
-	"path"
 	"regexp"
 	"sort"
 	"strconv"
@@ -50,6 +49,7 @@ type qwiklabsGitMDWriter struct {
 	env       string    // target environment
 	err       error     // error during any writeXxx methods
 	lineStart bool
+	listDepth int // nesting level of the items list being written
 }
 
 func (qw *qwiklabsGitMDWriter) writeBytes(b []byte) {
@@ -141,12 +141,28 @@ func (qw *qwiklabsGitMDWriter) write(nodes ...types.Node) error {
 }
 
 func (qw *qwiklabsGitMDWriter) text(n *types.TextNode) {
+	// roles are written as HTML, since attribute syntax is not understood by Qwiklabs
+	if n.Role != "" {
+		qw.writeString(`<span class="` + string(n.Role) + `">`)
+	}
 	if n.Bold {
 		qw.writeString("__")
 	}
 	if n.Italic {
 		qw.writeString("*")
 	}
+	if n.Strikethrough {
+		qw.writeString("~~")
+	}
+	if n.Underline {
+		qw.writeString("<u>")
+	}
+	if n.Superscript {
+		qw.writeString("<sup>")
+	}
+	if n.Subscript {
+		qw.writeString("<sub>")
+	}
 	if n.Code {
 		qw.writeString("`")
 	}
@@ -160,21 +176,52 @@ func (qw *qwiklabsGitMDWriter) text(n *types.TextNode) {
 	if n.Code {
 		qw.writeString("`")
 	}
+	if n.Subscript {
+		qw.writeString("</sub>")
+	}
+	if n.Superscript {
+		qw.writeString("</sup>")
+	}
+	if n.Underline {
+		qw.writeString("</u>")
+	}
+	if n.Strikethrough {
+		qw.writeString("~~")
+	}
 	if n.Italic {
 		qw.writeString("*")
 	}
 	if n.Bold {
 		qw.writeString("__")
 	}
+	if n.Role != "" {
+		qw.writeString("</span>")
+	}
 }
 
 func (qw *qwiklabsGitMDWriter) image(n *types.ImageNode) {
 	qw.space()
-	qw.writeString("![")
-	qw.writeString(sanitize(path.Base(n.Src)))
-	qw.writeString("](")
-	qw.writeString(sanitize(n.Src))
-	qw.writeString(")")
+	// markdown has no syntax for image size and alignment,
+	// while the size of images exported from docs is just their layout
+	if n.Sized || n.Align != "" || n.Inline {
+		qw.writeString(imageTag(n))
+	} else {
+		qw.writeString("![")
+		qw.writeString(sanitize(n.Alt))
+		qw.writeString("](")
+		qw.writeString(sanitize(n.Src))
+		if n.Title != "" {
+			qw.writeString(` "`)
+			qw.writeString(mdTitleEscaper.Replace(n.Title))
+			qw.writeString(`"`)
+		}
+		qw.writeString(")")
+	}
+	if n.Caption != "" {
+		qw.writeString("\n*")
+		qw.writeString(sanitize(n.Caption))
+		qw.writeString("*")
+	}
 }
 
 func (qw *qwiklabsGitMDWriter) url(n *types.URLNode) {
@@ -255,14 +302,24 @@ func (qw *qwiklabsGitMDWriter) list(n *types.ListNode) {
 }
 
 func (qw *qwiklabsGitMDWriter) itemsList(n *types.ItemsListNode) {
-	qw.newBlock()
+	// Nested lists start right on the next line of the parent item.
+	if qw.listDepth == 0 {
+		qw.newBlock()
+	} else if !qw.lineStart {
+		qw.writeBytes(newLine)
+	}
 	for i, item := range n.Items {
 		s := "* "
 		if n.Type() == types.NodeItemsList && n.Start > 0 {
 			s = strconv.Itoa(i+n.Start) + ". "
 		}
-		qw.writeString(s)
-		qw.write(item.Nodes...)
+		var buf bytes.Buffer
+		iw := &qwiklabsGitMDWriter{w: &buf, env: qw.env, lineStart: true, listDepth: qw.listDepth + 1}
+		if err := iw.write(item.Nodes...); err != nil {
+			qw.err = err
+			return
+		}
+		qw.writeString(s + indentItem(buf.String()))
 		if !qw.lineStart {
 			qw.writeBytes(newLine)
 		}
@@ -279,10 +336,14 @@ func (qw *qwiklabsGitMDWriter) grid(n *types.GridNode) {
 	for _, r := range n.Rows {
 		qw.writeString("<tr>")
 		for _, c := range r {
-			qw.writeFmt(`<td colspan="%d" rowspan="%d">`, c.Colspan, c.Rowspan)
+			tag := "td"
+			if c.Header {
+				tag = "th"
+			}
+			qw.writeFmt(`<%s colspan="%d" rowspan="%d">`, tag, c.Colspan, c.Rowspan)
 			// Use the existing HTML writer to transform the infobox body content.
 			WriteHTML(qw.w, qw.env, c.Content.Nodes...)
-			qw.writeString("</td>")
+			qw.writeFmt("</%s>", tag)
 		}
 		qw.writeString("</tr>\n")
 	}
@@ -129,12 +129,27 @@ func (qw *qwiklabsHTMLWriter) writeEscape(s string) {
 }
 
 func (qw *qwiklabsHTMLWriter) text(n *types.TextNode) {
+	if n.Role != "" {
+		qw.writeFmt(`<span class="%s">`, n.Role)
+	}
 	if n.Bold {
 		qw.writeString("<strong>")
 	}
 	if n.Italic {
 		qw.writeString("<em>")
 	}
+	if n.Strikethrough {
+		qw.writeString("<s>")
+	}
+	if n.Underline {
+		qw.writeString("<u>")
+	}
+	if n.Superscript {
+		qw.writeString("<sup>")
+	}
+	if n.Subscript {
+		qw.writeString("<sub>")
+	}
 	if n.Code {
 		qw.writeString("<code>")
 	}
@@ -143,23 +158,54 @@ func (qw *qwiklabsHTMLWriter) text(n *types.TextNode) {
 	if n.Code {
 		qw.writeString("</code>")
 	}
+	if n.Subscript {
+		qw.writeString("</sub>")
+	}
+	if n.Superscript {
+		qw.writeString("</sup>")
+	}
+	if n.Underline {
+		qw.writeString("</u>")
+	}
+	if n.Strikethrough {
+		qw.writeString("</s>")
+	}
 	if n.Italic {
 		qw.writeString("</em>")
 	}
 	if n.Bold {
 		qw.writeString("</strong>")
 	}
+	if n.Role != "" {
+		qw.writeString("</span>")
+	}
 }
 
 func (qw *qwiklabsHTMLWriter) image(n *types.ImageNode) {
+	if n.Caption != "" {
+		qw.writeString("<figure>")
+	}
 	qw.writeString("<img")
-	if n.MaxWidth > 0 {
-		qw.writeFmt(` style="max-width: %.2fpx"`, n.MaxWidth)
+	if s := imageStyle(n); s != "" {
+		qw.writeFmt(` style="%s"`, s)
+	}
+	qw.writeString(` alt="`)
+	qw.writeEscape(n.Alt)
+	qw.writeBytes(doubleQuote)
+	if n.Title != "" {
+		qw.writeString(` title="`)
+		qw.writeEscape(n.Title)
+		qw.writeBytes(doubleQuote)
 	}
 	qw.writeString(` src="`)
 	qw.writeString(n.Src)
 	qw.writeBytes(doubleQuote)
 	qw.writeBytes(greaterThan)
+	if n.Caption != "" {
+		qw.writeString("<figcaption>")
+		qw.writeEscape(n.Caption)
+		qw.writeString("</figcaption></figure>")
+	}
 }
 
 func (qw *qwiklabsHTMLWriter) url(n *types.URLNode) {
@@ -222,7 +268,7 @@ func (qw *qwiklabsHTMLWriter) code(n *types.CodeNode) {
 }
 
 func (qw *qwiklabsHTMLWriter) list(n *types.ListNode) {
-	wrap := n.Block() == true
+	wrap := n.Block() == true && figure(n) == nil
 	if wrap {
 		qw.writeString("<p>")
 	}
@@ -273,9 +319,13 @@ func (qw *qwiklabsHTMLWriter) grid(n *types.GridNode) {
 	for _, r := range n.Rows {
 		qw.writeString("<tr>")
 		for _, c := range r {
-			qw.writeFmt(`<td colspan="%d" rowspan="%d">`, c.Colspan, c.Rowspan)
+			tag := "td"
+			if c.Header {
+				tag = "th"
+			}
+			qw.writeFmt(`<%s colspan="%d" rowspan="%d">`, tag, c.Colspan, c.Rowspan)
 			qw.write(c.Content.Nodes...)
-			qw.writeString("</td>")
+			qw.writeFmt("</%s>", tag)
 		}
 		qw.writeString("</tr>\n")
 	}
@@ -15,6 +15,7 @@
 package render
 
 import (
+	"bytes"
 	"fmt"
 	htmlTemplate "html/template"
 	"io"
@@ -46,12 +47,18 @@ type Context struct {
 // for the built-in templates to be successfully executed.
 func Execute(w io.Writer, fmt string, data interface{}, opt ...Option) error {
 	var funcs map[string]interface{}
+	var theme *Theme
 	for _, o := range opt {
 		switch o := o.(type) {
 		case optFuncMap:
 			funcs = o
+		case optHighlight:
+			theme = o.theme
 		}
 	}
+	if theme != nil {
+		funcs = highlightFuncs(theme, funcs)
+	}
 	t, err := parseTemplate(fmt, funcs)
 	if err != nil {
 		return err
@@ -177,3 +184,44 @@ func WithFuncMap(fm map[string]interface{}) Option {
 type optFuncMap map[string]interface{}
 
 func (o optFuncMap) option() {}
+
+// WithHighlight creates an option to highlight code blocks server-side with theme t,
+// in the output of renderHTML and renderLite template functions.
+// Highlighted code is styled inline and needs no JavaScript to be displayed.
+func WithHighlight(t *Theme) Option {
+	return optHighlight{t}
+}
+
+type optHighlight struct {
+	theme *Theme
+}
+
+func (o optHighlight) option() {}
+
+// highlightFuncs returns a copy of fmap with renderHTML and renderLite
+// template functions highlighting code with theme t.
+// Functions of fmap take precedence.
+func highlightFuncs(t *Theme, fmap map[string]interface{}) map[string]interface{} {
+	funcs := map[string]interface{}{
+		"renderHTML": func(env string, nodes ...types.Node) (htmlTemplate.HTML, error) {
+			var buf bytes.Buffer
+			hw := htmlWriter{w: &buf, env: env, theme: t}
+			if err := hw.write(nodes...); err != nil {
+				return "", err
+			}
+			return htmlTemplate.HTML(buf.String()), nil
+		},
+		"renderLite": func(env string, nodes ...types.Node) (htmlTemplate.HTML, error) {
+			var buf bytes.Buffer
+			lw := liteWriter{w: &buf, env: env, theme: t}
+			if err := lw.write(nodes...); err != nil {
+				return "", err
+			}
+			return htmlTemplate.HTML(buf.String()), nil
+		},
+	}
+	for k, v := range fmap {
+		funcs[k] = v
+	}
+	return funcs
+}
@@ -44,10 +44,10 @@ func cmdServe() {
 	}
 	// Go get the dependencies.
 	if err := fetchRepo(depsDir, "google-codelab-elements", "googlecodelabs/codelab-components#2.0.2"); err != nil {
-		fatalf(err.Error())
+		fatalf("%v", err)
 	}
 	if err := writeFile(filepath.Join("elements", "codelab.html"), codelabElem); err != nil {
-		fatalf(err.Error())
+		fatalf("%v", err)
 	}
 
 	http.Handle("/", http.FileServer(http.Dir(".")))
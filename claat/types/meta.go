@@ -36,18 +36,24 @@ type Meta struct {
 	Feedback   string        `json:"feedback,omitempty"` // Issues and bugs are sent here
 	GA         string        `json:"ga,omitempty"`       // Codelab-specific GA tracking ID
 
+	// Extra contains metadata fields not known to the parsers, keyed by
+	// their lower-cased names.
+	Extra map[string]string `json:"extra,omitempty"`
+
 	URL string `json:"url"` // Legacy ID; TODO: remove
 }
 
 // Context is an export context.
 // It is defined in this package so that it can be used by both cli and a server.
 type Context struct {
-	Env     string       `json:"environment"`       // Current export environment
-	Source  string       `json:"source"`            // Codelab source doc
-	Format  string       `json:"format"`            // Output format, e.g. "html"
-	Prefix  string       `json:"prefix,omitempty"`  // Assets URL prefix for HTML-based formats
-	MainGA  string       `json:"mainga,omitempty"`  // Global Google Analytics ID
-	Updated *ContextTime `json:"updated,omitempty"` // Last update timestamp
+	Env       string       `json:"environment"`         // Current export environment
+	Source    string       `json:"source"`              // Codelab source doc
+	Format    string       `json:"format"`              // Output format, e.g. "html"
+	Prefix    string       `json:"prefix,omitempty"`    // Assets URL prefix for HTML-based formats
+	MainGA    string       `json:"mainga,omitempty"`    // Global Google Analytics ID
+	Style     string       `json:"style,omitempty"`     // Google Doc style profile file
+	Highlight string       `json:"highlight,omitempty"` // Theme of code highlighted server-side
+	Updated   *ContextTime `json:"updated,omitempty"`   // Last update timestamp
 }
 
 // ContextMeta is a composition of export context and meta data.
@@ -59,7 +65,44 @@ type ContextMeta struct {
 // Codelab is a top-level structure containing metadata and codelab steps.
 type Codelab struct {
 	Meta
-	Steps []*Step
+	Steps    []*Step
+	Warnings []*Warning // Non-fatal problems found while parsing the codelab
+}
+
+// Severity is the severity of a Warning.
+type Severity int
+
+// Warning severities, in increasing order.
+const (
+	SeverityInfo    Severity = iota // something worth knowing about the source
+	SeverityWarning                 // content may be rendered differently than expected
+	SeverityError                   // content was dropped or is likely broken
+)
+
+// String returns a short label of s, as used in reports.
+func (s Severity) String() string {
+	switch s {
+	case SeverityInfo:
+		return "info"
+	case SeverityWarning:
+		return "warn"
+	}
+	return "err"
+}
+
+// Warning is a non-fatal problem found while parsing a codelab source.
+type Warning struct {
+	Severity Severity
+	Pos      Pos    // Position of the problem in the source, if known
+	Msg      string // Description of the problem
+}
+
+// String returns w in the form "pos: msg", or just msg if the position is unknown.
+func (w *Warning) String() string {
+	if !w.Pos.IsValid() {
+		return w.Msg
+	}
+	return w.Pos.String() + ": " + w.Msg
 }
 
 // NewStep creates a new codelab step, adding it to c.Steps slice.
@@ -75,6 +118,7 @@ type Step struct {
 	Tags     []string      // Step environments
 	Duration time.Duration // Duration
 	Content  *ListNode     // Root node of the step nodes tree
+	Pos      Pos           // Position of the step title in the source
 }
 
 // ContextTime is codelab metadata timestamp.
@@ -16,6 +16,7 @@ package types
 
 import (
 	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -63,6 +64,44 @@ type Node interface {
 	Env() []string
 	// MutateEnv replaces current node environment tags with env.
 	MutateEnv(env []string)
+	// Pos returns the position of the node in its source, if known.
+	Pos() Pos
+	// MutatePos updates the position of the node in its source.
+	MutatePos(Pos)
+}
+
+// Pos is a position in a codelab source.
+// Markdown sources use Line and Col, while HTML-based sources,
+// such as Google Docs, use Path. The zero value means an unknown position.
+type Pos struct {
+	File string // source file, URL or doc ID; empty for the main codelab source
+	Line int    // 1-based line number
+	Col  int    // 1-based column, in bytes
+	Path string // element path, e.g. "body/table[2]/tbody[1]/tr[1]/td[1]"
+}
+
+// IsValid reports whether p is a known position.
+func (p Pos) IsValid() bool {
+	return p.Line > 0 || p.Path != ""
+}
+
+// String returns p in the form "file:line:col" or "file:path".
+// Unknown parts of the position are omitted.
+func (p Pos) String() string {
+	var parts []string
+	if p.File != "" {
+		parts = append(parts, p.File)
+	}
+	if p.Line > 0 {
+		parts = append(parts, strconv.Itoa(p.Line))
+		if p.Col > 0 {
+			parts = append(parts, strconv.Itoa(p.Col))
+		}
+	}
+	if p.Path != "" {
+		parts = append(parts, p.Path)
+	}
+	return strings.Join(parts, ":")
 }
 
 // IsItemsList returns true if t is one of ItemsListNode types.
@@ -94,6 +133,7 @@ type node struct {
 	typ   NodeType
 	block interface{}
 	env   []string
+	pos   Pos
 }
 
 func (b *node) Type() NodeType {
@@ -124,6 +164,46 @@ func (b *node) MutateEnv(e []string) {
 	sort.Strings(b.env)
 }
 
+func (b *node) Pos() Pos {
+	return b.pos
+}
+
+func (b *node) MutatePos(p Pos) {
+	b.pos = p
+}
+
+// Walk calls fn for each of nodes and all of their descendants, depth-first.
+// Content of import nodes is included.
+func Walk(nodes []Node, fn func(Node)) {
+	for _, n := range nodes {
+		fn(n)
+		switch n := n.(type) {
+		case *ListNode:
+			Walk(n.Nodes, fn)
+		case *ImportNode:
+			Walk([]Node{n.Content}, fn)
+		case *ItemsListNode:
+			for _, i := range n.Items {
+				Walk([]Node{i}, fn)
+			}
+		case *HeaderNode:
+			Walk([]Node{n.Content}, fn)
+		case *URLNode:
+			Walk([]Node{n.Content}, fn)
+		case *ButtonNode:
+			Walk([]Node{n.Content}, fn)
+		case *InfoboxNode:
+			Walk([]Node{n.Content}, fn)
+		case *GridNode:
+			for _, r := range n.Rows {
+				for _, c := range r {
+					Walk([]Node{c.Content}, fn)
+				}
+			}
+		}
+	}
+}
+
 // NewListNode creates a new Node of type NodeList.
 func NewListNode(nodes ...Node) *ListNode {
 	n := &ListNode{node: node{typ: NodeList}}
@@ -195,9 +275,11 @@ type GridNode struct {
 }
 
 // GridCell is a cell of GridNode.
+// Header cells label the row or column they belong to.
 type GridCell struct {
 	Colspan int
 	Rowspan int
+	Header  bool
 	Content *ListNode
 }
 
@@ -259,13 +341,28 @@ func NewTextNode(v string) *TextNode {
 	}
 }
 
+// TextRole defines the meaning of a TextNode, beyond its style.
+type TextRole string
+
+// TextNode roles.
+// The role value is used by renderers as a CSS class and in Markdown span syntax.
+const (
+	TextPlaceholder TextRole = "placeholder" // value for the reader to substitute, e.g. PROJECT_ID
+	TextUI          TextRole = "ui"          // label of a user interface element, e.g. a menu item
+)
+
 // TextNode is a simple node containing text as a string value.
 type TextNode struct {
 	node
-	Bold   bool
-	Italic bool
-	Code   bool
-	Value  string
+	Bold          bool
+	Italic        bool
+	Code          bool
+	Strikethrough bool
+	Underline     bool
+	Superscript   bool
+	Subscript     bool
+	Role          TextRole // semantic role, if any
+	Value         string
 }
 
 // Empty returns true if tn.Value is zero, excluding space runes.
@@ -289,11 +386,25 @@ type CodeNode struct {
 	Term  bool
 	Lang  string
 	Value string
+
+	// Include is the external source of a snippet included with a directive.
+	// Value is empty until the source is fetched.
+	Include *CodeInclude
 }
 
-// Empty returns true if cn.Value is zero, exluding space runes.
+// Empty returns true if cn.Value is zero, exluding space runes,
+// and the snippet is not to be included from an external source.
 func (cn *CodeNode) Empty() bool {
-	return strings.TrimSpace(cn.Value) == ""
+	return cn.Include == nil && strings.TrimSpace(cn.Value) == ""
+}
+
+// CodeInclude is a source file, or a part of it, included as a code snippet.
+// Only one of a line range or a region may be specified.
+type CodeInclude struct {
+	URL    string // location of the source file
+	Start  int    // first line to include, 1-based; zero means the beginning of the file
+	End    int    // last line to include, inclusive; zero means the end of the file
+	Region string // name of the region between "[START name]" and "[END name]" marker comments
 }
 
 // NewHeaderNode creates a new HeaderNode with optional content nodes n.
@@ -349,11 +460,29 @@ func NewImageNode(src string) *ImageNode {
 	}
 }
 
+// ImageAlign defines the alignment of an ImageNode relative to the surrounding text.
+type ImageAlign string
+
+// ImageNode alignments.
+// The zero value leaves the image where it is in the flow of text.
+const (
+	ImageAlignLeft   ImageAlign = "left"   // floated left, text wrapping on its right
+	ImageAlignRight  ImageAlign = "right"  // floated right, text wrapping on its left
+	ImageAlignCenter ImageAlign = "center" // centered on a line of its own
+)
+
 // ImageNode represents a single image.
 type ImageNode struct {
 	node
-	Src      string
-	MaxWidth float32
+	Src       string
+	Alt       string // alternative text
+	Title     string // advisory title, usually shown as a tooltip
+	Caption   string // visible caption, if any
+	MaxWidth  float32
+	MaxHeight float32
+	Sized     bool // MaxWidth or MaxHeight were set by the author, rather than exported with the image
+	Align     ImageAlign
+	Inline    bool // part of a line of text, such as an icon, rather than standing alone
 }
 
 // Empty returns true if its Src is zero, excluding space runes.
@@ -432,9 +561,13 @@ func NewInfoboxNode(k InfoboxKind, n ...Node) *InfoboxNode {
 type InfoboxKind string
 
 // InfoboxNode variations.
+// The kind value is used by renderers as the infobox CSS class.
 const (
-	InfoboxPositive InfoboxKind = "special"
-	InfoboxNegative InfoboxKind = "warning"
+	InfoboxPositive  InfoboxKind = "special"   // best practices and tips
+	InfoboxNegative  InfoboxKind = "warning"   // warnings and usage restrictions
+	InfoboxNote      InfoboxKind = "note"      // neutral side notes
+	InfoboxImportant InfoboxKind = "important" // information that must not be missed
+	InfoboxCaution   InfoboxKind = "caution"   // actions that may cause data loss or charges
 )
 
 // InfoboxNode is any regular header, a checklist header, or an FAQ header.
@@ -465,5 +598,5 @@ type YouTubeNode struct {
 
 // Empty returns true if yt's VideoID field is zero.
 func (yt *YouTubeNode) Empty() bool {
-	return yt.VideoID != ""
+	return yt.VideoID == ""
 }
@@ -26,11 +26,19 @@ import (
 	"strings"
 	"time"
 
+	"github.com/CloudVLab/tools/claat/parser/gdoc"
 	"github.com/CloudVLab/tools/claat/types"
 )
 
 // cmdUpdate is the "claat update ..." subcommand.
 func cmdUpdate() {
+	if _, err := highlightTheme(*highlight); err != nil {
+		fatalf("%v", err)
+	}
+	style, profile, err := readProfile(*styleFile)
+	if err != nil {
+		fatalf("%v", err)
+	}
 	roots := flag.Args()
 	if len(roots) == 0 {
 		roots = []string{"."}
@@ -46,6 +54,7 @@ func cmdUpdate() {
 	type result struct {
 		dir  string
 		meta *types.Meta
+		warn []*types.Warning
 		err  error
 	}
 	ch := make(chan *result, len(dirs))
@@ -54,12 +63,13 @@ func cmdUpdate() {
 			// random sleep up to 1 sec
 			// to reduce number of rate limit errors
 			time.Sleep(time.Duration(rand.Intn(1000)) * time.Millisecond)
-			meta, err := updateCodelab(d)
-			ch <- &result{d, meta, err}
+			meta, warn, err := updateCodelab(d, style, profile)
+			ch <- &result{d, meta, warn, err}
 		}(d)
 	}
 	for _ = range dirs {
 		res := <-ch
+		printWarnings(res.dir, res.warn)
 		if res.err != nil {
 			errorf(reportErr, res.dir, res.err)
 		} else {
@@ -71,11 +81,14 @@ func cmdUpdate() {
 // updateCodelab reads metadata from a dir/codelab.json file,
 // re-exports the codelab just like it normally would in exportCodelab,
 // and removes assets (images) which are not longer in use.
-func updateCodelab(dir string) (*types.Meta, error) {
+// A non-empty style overrides the style profile file of the metadata,
+// in which case Google Doc sources are parsed with profile.
+// The returned warnings are the non-fatal problems found while parsing the codelab source.
+func updateCodelab(dir, style string, profile *gdoc.StyleProfile) (*types.Meta, []*types.Warning, error) {
 	// get stored codelab metadata and fail early if we can't
 	meta, err := readMeta(filepath.Join(dir, metaFilename))
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	// override allowed options from cli
 	if *prefix != "" {
@@ -84,12 +97,27 @@ func updateCodelab(dir string) (*types.Meta, error) {
 	if *globalGA != "" {
 		meta.MainGA = *globalGA
 	}
+	if style != "" {
+		meta.Style = style
+	}
+	if *highlight != "" {
+		meta.Highlight = *highlight
+	}
+	if _, err := highlightTheme(meta.Highlight); err != nil {
+		return nil, nil, err
+	}
 
 	// fetch and parse codelab source
-	clab, err := slurpCodelab(meta.Source, true)
+	if style == "" {
+		if _, profile, err = readProfile(meta.Style); err != nil {
+			return nil, nil, err
+		}
+	}
+	clab, err := slurpCodelab(meta.Source, true, profile)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
+	warn := clab.Warnings
 	updated := types.ContextTime(clab.mod)
 	meta.Context.Updated = &updated
 
@@ -102,17 +130,17 @@ func updateCodelab(dir string) (*types.Meta, error) {
 	if clab.typ == srcGoogleDoc {
 		client, err = driveClient()
 		if err != nil {
-			return nil, err
+			return nil, warn, err
 		}
 	}
 	imgmap, err := slurpImages(client, meta.Source, imgdir, clab.Steps)
 	if err != nil {
-		return nil, err
+		return nil, warn, err
 	}
 
 	// write codelab and its metadata
 	if err := writeCodelab(newdir, clab.Codelab, &meta.Context); err != nil {
-		return nil, err
+		return nil, warn, err
 	}
 
 	// cleanup:
@@ -120,7 +148,7 @@ func updateCodelab(dir string) (*types.Meta, error) {
 	// - otherwise, remove images which are not in imgs
 	old := codelabDir(basedir, &meta.Meta)
 	if old != newdir {
-		return &meta.Meta, os.RemoveAll(old)
+		return &meta.Meta, warn, os.RemoveAll(old)
 	}
 	visit := func(p string, fi os.FileInfo, err error) error {
 		if err != nil || p == imgdir {
@@ -134,7 +162,7 @@ func updateCodelab(dir string) (*types.Meta, error) {
 		}
 		return nil
 	}
-	return &meta.Meta, filepath.Walk(imgdir, visit)
+	return &meta.Meta, warn, filepath.Walk(imgdir, visit)
 }
 
 // scanPaths looks for codelab metadata files in roots, recursively.